@@ -42,7 +42,7 @@ class DebugConsole extends React.Component<Props, {}> {
     }
 
     render() {
-        let {usable_balance, total_balance, events, loading_balance} = this.props.appStore;
+        let {usable_balance, total_balance, fiat_balance, events, loading_balance} = this.props.appStore;
         let eventItems = events.map(ev => {
             return <p key={ev.ts.getTime()}>
                 {
@@ -79,6 +79,14 @@ class DebugConsole extends React.Component<Props, {}> {
                                 <li>Total balance: {total_balance}i</li>
                                 <li>Usable balance: {usable_balance}i</li>
                                 <li>Non ready balance: {total_balance - usable_balance}i</li>
+                                {
+                                    fiat_balance &&
+                                    Object.keys(fiat_balance.total).map(currency => {
+                                        return <li key={currency}>
+                                            Total balance in {currency}: {fiat_balance.total[currency].toFixed(2)}
+                                        </li>
+                                    })
+                                }
                             </ul>
                     }
                 </div>
@@ -28,6 +28,10 @@ export const MsgType = {
     ReceivedMessage: 7,
     Error: 8,
     Balance: 9,
+    Sweep: 10,
+    GoalProgress: 11,
+    GoalReached: 12,
+    NewDonationAddress: 13,
 };
 
 class WsMsg {
@@ -57,11 +61,18 @@ export class Event {
     }
 }
 
+export class FiatBalance {
+    usable: { [currency: string]: number };
+    total: { [currency: string]: number };
+    rates_at: string;
+}
+
 export class ApplicationStore {
     @observable runningSince = 0;
     @observable cda: CDA = null;
     @observable usable_balance: number = 0;
     @observable total_balance: number = 0;
+    @observable fiat_balance: FiatBalance = null;
     @observable generating = false;
     @observable loading_balance = true;
     @observable events: Array<Event> = [];
@@ -76,7 +87,9 @@ export class ApplicationStore {
     }
 
     connectWS = () => {
-        this.ws = new WebSocket(`ws://${location.host}/account/live`);
+        // use wss:// if the page is served over HTTPS
+        let protocol = location.protocol === "https:" ? "wss" : "ws";
+        this.ws = new WebSocket(`${protocol}://${location.host}/account/live`);
         this.ws.onmessage = (e: MessageEvent) => {
             let obj: WsMsg = JSON.parse(e.data);
             let event;
@@ -123,11 +136,35 @@ export class ApplicationStore {
                     bundle = obj.data[0].bundle;
                     event = new Event(`sent bundle ${bundle} with tail ${tail}`, now, EventType.Info);
                     break;
+                case MsgType.Sweep:
+                    if (obj.data.error) {
+                        event = new Event(`sweep of ${obj.data.value}i to cold wallet failed: ${obj.data.error}`, now, EventType.Error);
+                        break;
+                    }
+                    event = new Event(`swept ${obj.data.value}i to cold wallet; bundle ${obj.data.id}`, now, EventType.Info);
+                    break;
+                case MsgType.GoalProgress:
+                    event = new Event(`raised ${obj.data.raised}i of ${obj.data.target}i (${obj.data.percent.toFixed(1)}%) from ${obj.data.donors} donors`, now, EventType.Info);
+                    break;
+                case MsgType.GoalReached:
+                    event = new Event(`goal of ${obj.data.target}i reached`, now, EventType.Info);
+                    break;
+                case MsgType.NewDonationAddress:
+                    // only the default campaign is shown, replace an already displayed address
+                    if (obj.data.campaign || !this.cda) {
+                        break;
+                    }
+                    event = new Event(`new donation address ${obj.data.cda.address}`, now, EventType.Info);
+                    runInAction(() => {
+                        this.cda = Object.assign(new CDA(), obj.data.cda);
+                    });
+                    break;
                 case MsgType.Balance:
                     event = new Event(`updated balance`, now, EventType.Info);
                     runInAction(() => {
                         this.usable_balance = obj.data.usable;
                         this.total_balance = obj.data.total;
+                        this.fiat_balance = obj.data.fiat || null;
                     });
                     break;
             }
@@ -151,6 +188,7 @@ export class ApplicationStore {
             runInAction(() => {
                 this.usable_balance = res.data.usable;
                 this.total_balance = res.data.total;
+                this.fiat_balance = res.data.fiat || null;
                 this.loading_balance = false;
             });
         } catch (err) {
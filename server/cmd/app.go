@@ -1,23 +1,93 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 	"github.com/luca-moser/donapoc/server/server"
+	"github.com/luca-moser/donapoc/server/server/config"
 )
 
 func main() {
-	srv := server.Server{}
+	opts := config.Options{}
+	flag.StringVar(&opts.Dir, "config-dir", "./configs", "the directory holding the config files")
+	flag.StringVar(&opts.Env, "env", os.Getenv(config.EnvVar), "the environment whose config overlays are loaded, e.g. 'prod' for app.prod.json")
+	flag.StringVar(&opts.DataDir, "data-dir", "", "the directory against which relative paths are resolved, overrides the config")
+	flag.Parse()
+
+	if flag.NArg() > 0 {
+		os.Exit(runCommand(opts, flag.Arg(0), flag.Args()[1:]))
+	}
+
+	srv := server.Server{Options: opts}
 
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
+	// SIGHUP reloads the config
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
 
-	srv.Start()
-	select {
-	case <-sigs:
-		srv.Shutdown(time.Duration(1500) * time.Millisecond)
+	if err := srv.Start(); err != nil {
+		fmt.Fprintln(os.Stderr, "unable to start app:", err)
+		os.Exit(1)
 	}
+	for {
+		select {
+		case <-reload:
+			if err := srv.Reload(); err != nil {
+				fmt.Fprintln(os.Stderr, "unable to reload config:", err)
+			}
+		case <-sigs:
+			if err := srv.Shutdown(time.Duration(1500) * time.Millisecond); err != nil {
+				os.Exit(1)
+			}
+			return
+		}
+	}
+}
 
-}
\ No newline at end of file
+// runCommand runs the given maintenance command and returns the exit code.
+func runCommand(opts config.Options, name string, args []string) int {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	var err error
+	switch name {
+	case "export":
+		// usage: export <file>
+		fs.Parse(args)
+		if fs.NArg() != 1 {
+			fmt.Fprintln(os.Stderr, "usage: export <file>")
+			return 2
+		}
+		err = server.ExportState(opts, fs.Arg(0))
+	case "import":
+		// usage: import [-force] <file>
+		force := fs.Bool("force", false, "import a state exported from another account")
+		fs.Parse(args)
+		if fs.NArg() != 1 {
+			fmt.Fprintln(os.Stderr, "usage: import [-force] <file>")
+			return 2
+		}
+		err = server.ImportState(opts, fs.Arg(0), *force)
+	case "keystore":
+		// usage: keystore [-out <file>] [-tenant <id>]
+		out := fs.String("out", "./configs/seed.keystore", "the keystore file to create")
+		tenant := fs.String("tenant", "", "convert the seed of the given tenant")
+		fs.Parse(args)
+		err = server.ConvertSeed(opts, *out, *tenant)
+	case "check-config":
+		// usage: check-config
+		fs.Parse(args)
+		err = server.CheckConfig(opts)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command '%s', available: export, import, keystore, check-config\n", name)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
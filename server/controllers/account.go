@@ -2,18 +2,23 @@ package controllers
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
 	"encoding/gob"
+	"encoding/hex"
 	"github.com/iotaledger/iota.go/account"
 	"github.com/iotaledger/iota.go/account/builder"
 	"github.com/iotaledger/iota.go/account/deposit"
 	"github.com/iotaledger/iota.go/account/event"
+	"github.com/iotaledger/iota.go/account/plugins/promoter"
 	"github.com/iotaledger/iota.go/account/plugins/transfer/poller"
-	badger_store "github.com/iotaledger/iota.go/account/store/badger"
-	mongo_store "github.com/iotaledger/iota.go/account/store/mongo"
+	"github.com/iotaledger/iota.go/account/store"
 	"github.com/iotaledger/iota.go/account/timesrc"
 	"github.com/iotaledger/iota.go/api"
 	"github.com/iotaledger/iota.go/consts"
+	"github.com/luca-moser/donapoc/server/metrics"
 	"github.com/luca-moser/donapoc/server/server/config"
+	"github.com/luca-moser/donapoc/server/storage"
 	"github.com/luca-moser/donapoc/server/utilities"
 	"github.com/pkg/errors"
 	"gopkg.in/inconshreveable/log15.v2"
@@ -24,65 +29,95 @@ import (
 	"time"
 )
 
+// deposit condition file of earlier versions, only read for importing it into the store
 const currentCondsFile = "./current"
 
+// donation modes
+const (
+	// every visitor gets the same multi-use deposit address
+	DonationModeShared = "shared"
+	// every visitor session gets its own single-use deposit address
+	DonationModePerVisitor = "per_visitor"
+)
+
+const defaultVisitorAddressTimeout = time.Duration(30) * time.Minute
+const defaultMaxVisitorAddressesPerClient = 5
+
+var ErrInvalidDonationMode = errors.New("invalid donation mode")
+var ErrInvalidCampaign = errors.New("invalid campaign")
+var ErrCampaignNotFound = errors.New("campaign not found")
+var ErrDonationsClosed = errors.New("donations are closed")
+var ErrTooManyVisitorAddresses = errors.New("too many open visitor deposit addresses")
+
 type AccCtrl struct {
-	Acc         account.Account
-	EM          event.EventMachine
-	iota        *api.API
-	store       *badger_store.BadgerStore
-	Config      *config.Configuration `inject:""`
-	current     *deposit.CDA
+	// empty for the main account
+	TenantID string
+	Acc      account.Account
+	EM       event.EventMachine
+	iota     *api.API
+	addrGen  account.AddrGenFunc
+	settings *account.Settings
+	plugins  []*ManagedPlugin
+	store    store.Store
+	srvStore storage.Store
+	Config   *config.Configuration `inject:""`
+	// guards the API, the settings and the fields of the config which are reloaded at runtime
+	reloadMu      sync.RWMutex
+	receiveFilter poller.ReceiveEventFilter
+	// current shared deposit conditions by campaign, the default campaign has an empty id
+	current     map[string]*deposit.CDA
 	checkCondMu sync.Mutex
-	logger      log15.Logger
+	// pre-allocated next shared deposit conditions by campaign
+	next         map[string]*deposit.CDA
+	rotateMu     sync.Mutex
+	rotationExit chan struct{}
+	rotationDone chan struct{}
+	rotationStop sync.Once
+	visitors     map[string]*visitorCDA
+	visitorsMu   sync.Mutex
+	stateMu      sync.Mutex
+	closed       bool
+	running      bool
+	logger       log15.Logger
 }
 
 func (ac *AccCtrl) Init() error {
 	logger, _ := utilities.GetLogger("acc")
+	if ac.TenantID != "" {
+		logger = logger.New("tenant", ac.TenantID)
+	}
 	ac.logger = logger
+	ac.visitors = map[string]*visitorCDA{}
+	ac.current = map[string]*deposit.CDA{}
+	ac.next = map[string]*deposit.CDA{}
 
-	// register deposit condition gob
-	gob.Register(deposit.CDA{})
-
-	// read in existing deposit condition
-	if _, err := os.Stat(currentCondsFile); err == nil {
-		logger.Info("reading in existing deposit condition")
-		currentBytes, err := ioutil.ReadFile(currentCondsFile)
-		if err != nil {
-			return err
-		}
-		dec := gob.NewDecoder(bytes.NewReader(currentBytes))
-		currentCond := &deposit.CDA{}
-		if err := dec.Decode(currentCond); err != nil {
-			return err
-		}
-		ac.current = currentCond
-		logger.Info("successfully read in current deposit conditions")
+	switch ac.DonationMode() {
+	case DonationModeShared, DonationModePerVisitor:
+	default:
+		return errors.Wrapf(ErrInvalidDonationMode, "'%s'", ac.Config.App.Account.DonationMode)
+	}
+	if err := ac.checkCampaigns(); err != nil {
+		return err
 	}
 
 	conf := ac.Config.App.Account
 
 	// init quorumed (what a word) api
-	quorumConf := conf.Quorum
-	httpClient := &http.Client{Timeout: time.Duration(quorumConf.Timeout) * time.Second}
-	a, err := api.ComposeAPI(api.QuorumHTTPClientSettings{
-		PrimaryNode:                &quorumConf.PrimaryNode,
-		Threshold:                  quorumConf.Threshold,
-		NoResponseTolerance:        quorumConf.NoResponseTolerance,
-		Client:                     httpClient,
-		Nodes:                      quorumConf.Nodes,
-		MaxSubtangleMilestoneDelta: quorumConf.MaxSubtangleMilestoneDelta,
-	}, api.NewQuorumHTTPClient)
+	a, err := newQuorumAPI(conf.Quorum)
 	if err != nil {
-		return errors.Wrap(err, "unable to construct IOTA API")
+		return err
 	}
 	ac.iota = a
 
-	// make sure data dir exists
-	mongoConf := conf.MongoDB
-	dataStore, err := mongo_store.NewMongoStore(mongoConf.URI, &mongo_store.Config{
-		DBName: mongoConf.DBName, CollName: mongoConf.CollName,
-	})
+	seed, err := ac.loadSeed()
+	if err != nil {
+		return err
+	}
+
+	// init stores
+	if err := ac.initStores(); err != nil {
+		return err
+	}
 
 	// init NTP time source
 	ntpClock := timesrc.NewNTPTimeSource(conf.Time.NTPServer)
@@ -93,61 +128,450 @@ func (ac *AccCtrl) Init() error {
 	// init account
 	b := builder.NewBuilder().
 		WithAPI(a).
-		WithStore(dataStore).
-		WithSeed(conf.Seed).
+		WithStore(ac.store).
+		WithSeed(seed).
 		WithTimeSource(ntpClock).
 		WithSecurityLevel(consts.SecurityLevel(conf.SecurityLevel)).
 		WithMWM(conf.MWM).
 		WithDepth(conf.GTTADepth).
 		WithEvents(em)
 
-	// create a poller which will check for incoming transfers
-	transferPoller := poller.NewTransferPoller(
-		b.Settings(), poller.NewPerTailReceiveEventFilter(true),
-		time.Duration(conf.TransferPollInterval)*time.Second,
-	)
+	// the filter is shared by all poller instances so that a resumed poller doesn't emit deposits twice.
+	settings := b.Settings()
+	ac.receiveFilter = poller.NewPerTailReceiveEventFilter(true)
+	factories := ac.pluginFactories(settings, conf)
+	ac.plugins = make([]*ManagedPlugin, len(factories))
+	plugins := make([]account.Plugin, len(factories))
+	for i, create := range factories {
+		ac.plugins[i] = newManagedPlugin(create)
+		plugins[i] = ac.plugins[i]
+	}
+	if conf.PromoteReattach {
+		logger.Info("promoter/reattacher enabled", "interval", conf.PromoteReattachInterval)
+	}
 
-	acc, err := b.Build(transferPoller)
+	acc, err := b.Build(plugins...)
 	if err != nil {
 		return errors.Wrap(err, "unable to instantiate account")
 	}
 	if err := acc.Start(); err != nil {
 		return err
 	}
-	ac.Acc = acc
+	// set up by the builder, used to derive the addresses of the stored deposit requests
+	ac.addrGen = settings.AddrGen
+	ac.settings = settings
+	// the latency of deposit address allocations and balance queries is exposed as metrics
+	ac.Acc = metrics.InstrumentAccount(acc, ac.TenantID)
 	ac.EM = em
+	ac.setRunning(true)
+	em.RegisterListener(func(data interface{}) {
+		ac.setRunning(false)
+	}, event.EventShutdown)
+
+	if ac.TenantID == "" {
+		if err := ac.importLegacyConditions(); err != nil {
+			return errors.Wrap(err, "unable to import legacy deposit condition")
+		}
+	}
+	if err := ac.restoreConditions(); err != nil {
+		return err
+	}
+	ac.startRotation()
 	return nil
 }
 
-func (ac *AccCtrl) refreshConditions() error {
-	ac.logger.Info("generating new deposit condition as current one expires in 24h")
-	timeoutAt := time.Now().AddDate(0, 0, int(ac.Config.App.Account.AddressValidityTimeoutDays))
-	newDepCond, err := ac.Acc.AllocateDepositAddress(&deposit.Conditions{TimeoutAt: &timeoutAt, MultiUse: true})
+// newQuorumAPI composes the API querying the nodes of the given quorum.
+func newQuorumAPI(quorumConf config.QuorumConfig) (*api.API, error) {
+	httpClient := &http.Client{Timeout: time.Duration(quorumConf.Timeout) * time.Second}
+	a, err := api.ComposeAPI(api.QuorumHTTPClientSettings{
+		PrimaryNode:                &quorumConf.PrimaryNode,
+		Threshold:                  quorumConf.Threshold,
+		NoResponseTolerance:        quorumConf.NoResponseTolerance,
+		Client:                     httpClient,
+		Nodes:                      quorumConf.Nodes,
+		MaxSubtangleMilestoneDelta: quorumConf.MaxSubtangleMilestoneDelta,
+	}, api.NewQuorumHTTPClient)
 	if err != nil {
+		return nil, errors.Wrap(err, "unable to construct IOTA API")
+	}
+	return a, nil
+}
+
+// pluginFactories returns the functions creating the instances of the account's plugins using the given settings:
+// a poller which will check for incoming transfers and, if enabled, a promoter/reattacher which takes care of
+// trying to get pending transfers (payouts) to confirm.
+func (ac *AccCtrl) pluginFactories(settings *account.Settings, conf config.AccountConfig) []func() account.Plugin {
+	pollInterval := time.Duration(conf.TransferPollInterval) * time.Second
+	factories := []func() account.Plugin{func() account.Plugin {
+		return poller.NewTransferPoller(settings, ac.receiveFilter, pollInterval)
+	}}
+	if conf.PromoteReattach {
+		promoteInterval := time.Duration(conf.PromoteReattachInterval) * time.Second
+		factories = append(factories, func() account.Plugin {
+			return promoter.NewPromoter(settings, promoteInterval)
+		})
+	}
+	return factories
+}
+
+// Shutdown shuts down the account with all its plugins and closes the stores.
+func (ac *AccCtrl) Shutdown(ctx context.Context) error {
+	done := make(chan error, 1)
+	go func() {
+		ac.stopRotation()
+		// the account is already shut down if it was suspended
+		if ac.Acc != nil && ac.Running() {
+			ac.setRunning(false)
+			ac.logger.Info("shutting down account")
+			if err := ac.Acc.Shutdown(); err != nil {
+				done <- errors.Wrap(err, "unable to shutdown account")
+				return
+			}
+		}
+		done <- ac.closeStores()
+	}()
+	select {
+	case err := <-done:
 		return err
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "account shutdown did not finish in time")
 	}
-	var buf bytes.Buffer
-	enc := gob.NewEncoder(&buf)
-	if err := enc.Encode(newDepCond); err != nil {
+}
+
+// Suspend stops the rotation and shuts the account down while keeping its stores open,
+// e.g. to import an account state which takes effect once the server is restarted.
+func (ac *AccCtrl) Suspend() error {
+	ac.stopRotation()
+	if !ac.Running() {
+		return nil
+	}
+	ac.setRunning(false)
+	ac.logger.Warn("suspending account, the server must be restarted")
+	return ac.Acc.Shutdown()
+}
+
+// importLegacyConditions imports the deposit condition of the gob file used by earlier
+// versions into the store and then moves the file out of the way.
+func (ac *AccCtrl) importLegacyConditions() error {
+	condsFile := ac.Config.App.DataPath(currentCondsFile)
+	if _, err := os.Stat(condsFile); err != nil {
+		return nil
+	}
+	ac.logger.Info("importing deposit condition from legacy file", "file", condsFile)
+	currentBytes, err := ioutil.ReadFile(condsFile)
+	if err != nil {
 		return err
 	}
-	if err := ioutil.WriteFile(currentCondsFile, buf.Bytes(), os.ModePerm); err != nil {
+	gob.Register(deposit.CDA{})
+	dec := gob.NewDecoder(bytes.NewReader(currentBytes))
+	currentCond := &deposit.CDA{}
+	if err := dec.Decode(currentCond); err != nil {
 		return err
 	}
-	ac.current = newDepCond
+
+	// the store is authoritative if it already holds a current deposit condition
+	current, err := ac.srvStore.CurrentCDA(ac.Acc.ID(), "")
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		if err := ac.srvStore.SetCurrentCDA(storage.NewCDA(ac.Acc.ID(), currentCond)); err != nil {
+			return err
+		}
+		ac.logger.Info("imported legacy deposit condition", "address", currentCond.Address)
+	}
+	return os.Rename(condsFile, condsFile+".imported")
+}
+
+// restoreConditions rebuilds the current deposit conditions of all campaigns and the visitor sessions from the store.
+func (ac *AccCtrl) restoreConditions() error {
+	for _, campaignID := range ac.campaignIDs() {
+		current, err := ac.srvStore.CurrentCDA(ac.Acc.ID(), campaignID)
+		if err != nil {
+			return errors.Wrap(err, "unable to load current deposit condition")
+		}
+		if current != nil {
+			ac.current[campaignID] = current.AsCDA()
+			ac.logger.Info("restored current deposit condition", "address", current.Address, "campaign", campaignID)
+		}
+	}
+
+	recs, err := ac.srvStore.CDAs(ac.Acc.ID())
+	if err != nil {
+		return errors.Wrap(err, "unable to load deposit conditions")
+	}
+	now := time.Now()
+	for _, rec := range recs {
+		if rec.TimeoutAt.Before(now) {
+			continue
+		}
+		if rec.Next && !rec.Current {
+			if next := ac.next[rec.Campaign]; next == nil || next.TimeoutAt.Before(*rec.TimeoutAt) {
+				ac.next[rec.Campaign] = rec.AsCDA()
+			}
+			continue
+		}
+		if rec.Session == "" {
+			continue
+		}
+		// the client isn't persisted, so restored addresses don't count towards the maximum of a client
+		key := visitorKey(rec.Campaign, rec.Session)
+		visitor, ok := ac.visitors[key]
+		if !ok {
+			ac.visitors[key] = &visitorCDA{cda: rec.AsCDA()}
+			continue
+		}
+		// the session got a new address when the expected amount changed, the latest one is handed out
+		cda := rec.AsCDA()
+		if visitor.cda.TimeoutAt.Before(*cda.TimeoutAt) {
+			visitor.cda, cda = cda, visitor.cda
+		}
+		visitor.replaced = append(visitor.replaced, cda)
+	}
 	return nil
 }
 
-// GenerateNewDonationAddress returns the current valid deposit conditions or a new one
-func (ac *AccCtrl) GenerateNewDonationAddress() (*deposit.CDA, error) {
-	ac.checkCondMu.Lock()
-	defer ac.checkCondMu.Unlock()
-	// if the current deposit address will expire within 24 hours, we generate a new one
-	if ac.current == nil || ac.current.TimeoutAt.Before(time.Now().AddDate(0, 0, 1)) {
-		if err := ac.refreshConditions(); err != nil {
-			return nil, err
+// RotateConditions replaces the current shared deposit address of the given campaign with the
+// pre-allocated next one or a new one, regardless of how long the current one is still valid.
+func (ac *AccCtrl) RotateConditions(campaignID string) (*deposit.CDA, error) {
+	ac.rotateMu.Lock()
+	defer ac.rotateMu.Unlock()
+	if err := ac.rotate(campaignID); err != nil {
+		return nil, err
+	}
+	return ac.currentConditions(campaignID), nil
+}
+
+// GenerateNewDonationAddress returns the current valid deposit conditions of the given campaign.
+// The default campaign has an empty id. The conditions are rotated by the scheduler in the background,
+// an address is only allocated in the request if the scheduler couldn't provide one in time.
+func (ac *AccCtrl) GenerateNewDonationAddress(campaignID string) (*deposit.CDA, error) {
+	if ac.DonationsClosed() {
+		return nil, ErrDonationsClosed
+	}
+	if current := ac.currentConditions(campaignID); usableSharedConditions(current) {
+		return current, nil
+	}
+
+	ac.rotateMu.Lock()
+	defer ac.rotateMu.Unlock()
+	// another request might have rotated the conditions in the meantime
+	if current := ac.currentConditions(campaignID); usableSharedConditions(current) {
+		return current, nil
+	}
+	ac.logger.Warn("no usable deposit address available, rotating in request", "campaign", campaignID)
+	if err := ac.rotate(campaignID); err != nil {
+		return nil, err
+	}
+	return ac.currentConditions(campaignID), nil
+}
+
+func usableSharedConditions(cda *deposit.CDA) bool {
+	return cda != nil && cda.TimeoutAt.After(time.Now().Add(minSharedAddressValidity))
+}
+
+func (ac *AccCtrl) setRunning(running bool) {
+	ac.stateMu.Lock()
+	defer ac.stateMu.Unlock()
+	ac.running = running
+}
+
+// Running tells whether the account is started and not yet shut down.
+func (ac *AccCtrl) Running() bool {
+	ac.stateMu.Lock()
+	defer ac.stateMu.Unlock()
+	return ac.running
+}
+
+// CloseDonations stops handing out donation links. Deposits to already handed out addresses are still received.
+func (ac *AccCtrl) CloseDonations() {
+	ac.stateMu.Lock()
+	defer ac.stateMu.Unlock()
+	ac.closed = true
+}
+
+// DonationsClosed tells whether donation links are no longer handed out.
+func (ac *AccCtrl) DonationsClosed() bool {
+	ac.stateMu.Lock()
+	defer ac.stateMu.Unlock()
+	return ac.closed
+}
+
+// DonationMode returns the configured donation mode, defaulting to the shared mode.
+func (ac *AccCtrl) DonationMode() string {
+	if ac.Config.App.Account.DonationMode == "" {
+		return DonationModeShared
+	}
+	return ac.Config.App.Account.DonationMode
+}
+
+const visitorSessionSize = 16
+
+// NewVisitorSession generates a new random visitor session id.
+func NewVisitorSession() (string, error) {
+	b := make([]byte, visitorSessionSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// IsVisitorSession tells whether the given value is a session id as generated by NewVisitorSession.
+func IsVisitorSession(session string) bool {
+	if len(session) != hex.EncodedLen(visitorSessionSize) {
+		return false
+	}
+	_, err := hex.DecodeString(session)
+	return err == nil
+}
+
+// visitorCDA is the deposit address handed out to a visitor session.
+type visitorCDA struct {
+	cda *deposit.CDA
+	// the addresses which were handed out to the session before the expected amount changed,
+	// the account keeps monitoring them until they expire
+	replaced []*deposit.CDA
+	// the client (IP) which requested the address
+	client string
+	// closed once the pending allocation of a new address finished, nil if none is pending
+	allocating chan struct{}
+}
+
+// open returns the number of usable addresses of the visitor, counting a pending allocation as one.
+func (visitor *visitorCDA) open(now time.Time) uint64 {
+	var open uint64
+	if visitor.allocating != nil {
+		open++
+	}
+	if visitor.cda != nil && usableVisitorConditions(visitor.cda, now) {
+		open++
+	}
+	for _, cda := range visitor.replaced {
+		if usableVisitorConditions(cda, now) {
+			open++
 		}
 	}
+	return open
+}
 
-	return ac.current, nil
+// the account refuses conditions which expire within 2 minutes, so we give a donor at least 5 minutes
+func usableVisitorConditions(cda *deposit.CDA, now time.Time) bool {
+	return cda.TimeoutAt.After(now.Add(time.Duration(5) * time.Minute))
+}
+
+func visitorKey(campaignID string, session string) string {
+	return campaignID + "/" + session
+}
+
+// GenerateVisitorDonationAddress returns the single-use deposit conditions of the given visitor session for the given campaign.
+// New conditions are allocated if the session has none yet, they are about to expire or the expected amount changed,
+// as the amount is part of the conditions monitored by the account.
+// A client can't hold more than the configured maximum of usable addresses, so that it can't exhaust the account
+// by requesting addresses with ever new sessions or amounts.
+func (ac *AccCtrl) GenerateVisitorDonationAddress(campaignID string, session string, client string, expectedAmount *uint64) (*deposit.CDA, error) {
+	if ac.DonationsClosed() {
+		return nil, ErrDonationsClosed
+	}
+	key := visitorKey(campaignID, session)
+	for {
+		cda, pending, err := ac.reserveVisitorAddress(key, client, expectedAmount)
+		if err != nil || cda != nil {
+			return cda, err
+		}
+		if pending == nil {
+			break
+		}
+		// another request of the session is allocating an address, which might fit this request too
+		<-pending
+	}
+
+	// the allocation queries the node, so it happens outside of the lock in order to not block other visitors
+	timeout := defaultVisitorAddressTimeout
+	if mins := ac.Config.App.Account.VisitorAddressTimeoutMinutes; mins != 0 {
+		timeout = time.Duration(mins) * time.Minute
+	}
+	timeoutAt := time.Now().Add(timeout)
+	cda, err := ac.Acc.AllocateDepositAddress(&deposit.Conditions{TimeoutAt: &timeoutAt, ExpectedAmount: expectedAmount})
+	if err == nil {
+		ac.logger.Info("allocated visitor deposit address", "address", cda.Address, "timeout_at", timeoutAt, "campaign", campaignID)
+		rec := storage.NewCDA(ac.Acc.ID(), cda)
+		rec.Session = session
+		rec.Campaign = campaignID
+		err = ac.srvStore.AddCDA(rec)
+	}
+
+	ac.visitorsMu.Lock()
+	defer ac.visitorsMu.Unlock()
+	visitor := ac.visitors[key]
+	close(visitor.allocating)
+	visitor.allocating = nil
+	if err != nil {
+		if visitor.cda == nil && len(visitor.replaced) == 0 {
+			delete(ac.visitors, key)
+		}
+		return nil, err
+	}
+	if visitor.cda != nil && visitor.cda.TimeoutAt.After(time.Now()) {
+		visitor.replaced = append(visitor.replaced, visitor.cda)
+	}
+	visitor.cda = cda
+	return cda, nil
+}
+
+// reserveVisitorAddress returns the usable conditions of the given visitor session if they match the expected amount.
+// Otherwise it reserves the allocation of new conditions for the caller and returns neither conditions nor a channel,
+// unless another allocation of the session is pending, whose channel is returned then.
+func (ac *AccCtrl) reserveVisitorAddress(key string, client string, expectedAmount *uint64) (*deposit.CDA, <-chan struct{}, error) {
+	maxPerClient := ac.Config.App.Account.MaxVisitorAddressesPerClient
+	if maxPerClient == 0 {
+		maxPerClient = defaultMaxVisitorAddressesPerClient
+	}
+	now := time.Now()
+
+	ac.visitorsMu.Lock()
+	defer ac.visitorsMu.Unlock()
+	var open uint64
+	for id, visitor := range ac.visitors {
+		// drop expired addresses and sessions
+		replaced := visitor.replaced[:0]
+		for _, cda := range visitor.replaced {
+			if cda.TimeoutAt.After(now) {
+				replaced = append(replaced, cda)
+			}
+		}
+		visitor.replaced = replaced
+		if visitor.allocating == nil && visitor.cda.TimeoutAt.Before(now) && len(visitor.replaced) == 0 {
+			delete(ac.visitors, id)
+			continue
+		}
+		if visitor.client == client {
+			open += visitor.open(now)
+		}
+	}
+
+	visitor, ok := ac.visitors[key]
+	if ok && visitor.allocating != nil {
+		return nil, visitor.allocating, nil
+	}
+	if ok && visitor.cda != nil && usableVisitorConditions(visitor.cda, now) && sameAmount(visitor.cda.ExpectedAmount, expectedAmount) {
+		return visitor.cda, nil, nil
+	}
+	if open >= maxPerClient {
+		ac.logger.Warn("refused visitor deposit address", "client", client, "open", open)
+		return nil, nil, ErrTooManyVisitorAddresses
+	}
+	if !ok {
+		visitor = &visitorCDA{client: client}
+		ac.visitors[key] = visitor
+	}
+	visitor.client = client
+	visitor.allocating = make(chan struct{})
+	return nil, nil, nil
+}
+
+func sameAmount(a *uint64, b *uint64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
 }
@@ -0,0 +1,208 @@
+package controllers
+
+import (
+	"github.com/iotaledger/iota.go/account"
+	"github.com/iotaledger/iota.go/account/deposit"
+	"github.com/iotaledger/iota.go/account/store"
+	"github.com/iotaledger/iota.go/bundle"
+	"github.com/iotaledger/iota.go/checksum"
+	"github.com/iotaledger/iota.go/consts"
+	"github.com/iotaledger/iota.go/guards"
+	"github.com/luca-moser/donapoc/server/statefile"
+	"github.com/luca-moser/donapoc/server/utilities"
+	"github.com/pkg/errors"
+	"gopkg.in/inconshreveable/log15.v2"
+	"sort"
+)
+
+var ErrInvalidAddress = errors.New("invalid address")
+var ErrInvalidPayout = errors.New("invalid payout")
+
+// checkAddress ensures that the given address includes a valid checksum.
+func checkAddress(address string) error {
+	if len(address) != consts.AddressWithChecksumTrytesSize || !guards.IsTrytes(address) {
+		return errors.Wrap(ErrInvalidAddress, "address must be 90 trytes including the checksum")
+	}
+	withChecksum, err := checksum.AddChecksum(address[:consts.HashTrytesSize], true, consts.AddressChecksumTrytesSize)
+	if err != nil || withChecksum != address {
+		return errors.Wrap(ErrInvalidAddress, "address has an invalid checksum")
+	}
+	return nil
+}
+
+// PendingTransfer is an outgoing transfer of the account which isn't confirmed yet.
+type PendingTransfer struct {
+	// the tail transaction hash of the originally sent bundle
+	OriginTail string `json:"origin_tail"`
+	BundleHash string `json:"bundle_hash"`
+	// the tails of the reattachments and the original bundle
+	Tails      []string            `json:"tails"`
+	Recipients []account.Recipient `json:"recipients"`
+}
+
+// PluginState is the state of an account plugin.
+type PluginState struct {
+	Name   string `json:"name"`
+	Paused bool   `json:"paused"`
+}
+
+// AdminCtrl executes the operator actions of the admin API. Every action is logged.
+type AdminCtrl struct {
+	AccCtrl *AccCtrl `inject:""`
+	logger  log15.Logger
+}
+
+func (adc *AdminCtrl) Init() error {
+	logger, _ := utilities.GetLogger("admin")
+	adc.logger = logger
+	return nil
+}
+
+// State returns the account state as persisted in the store.
+func (adc *AdminCtrl) State() (*store.AccountState, error) {
+	return adc.AccCtrl.store.LoadAccount(adc.AccCtrl.Acc.ID())
+}
+
+// ExportState exports the account state as written to state files.
+func (adc *AdminCtrl) ExportState(actor string) (*statefile.State, error) {
+	state, err := statefile.Export(adc.AccCtrl.store, adc.AccCtrl.Acc.ID())
+	if err != nil {
+		return nil, err
+	}
+	adc.logger.Info("exported account state", "actor", actor, "state", state.Summary())
+	return state, nil
+}
+
+// ImportState overrides the account state with the given one. As the running account keeps
+// its key index in memory, the account is suspended first and the server must be restarted afterwards.
+func (adc *AdminCtrl) ImportState(actor string, state *statefile.State, force bool) error {
+	accountID := adc.AccCtrl.Acc.ID()
+	// the account can't be resumed once it is suspended, so the state is checked beforehand
+	if err := state.Check(accountID, force); err != nil {
+		return err
+	}
+	adc.logger.Warn("importing account state", "actor", actor, "state", state.Summary())
+	if err := adc.AccCtrl.Suspend(); err != nil {
+		return errors.Wrap(err, "unable to suspend account")
+	}
+	if err := statefile.Import(adc.AccCtrl.store, state, accountID, force); err != nil {
+		adc.logger.Error("account state import failed, the previous state is kept, restart the server to resume the account",
+			"actor", actor, "err", err)
+		return errors.Wrap(err, "account state import failed, the account is suspended until the server is restarted")
+	}
+	adc.logger.Warn("imported account state, restart the server to load it", "actor", actor)
+	return nil
+}
+
+// RotateConditions forces a new shared deposit address for the given campaign.
+func (adc *AdminCtrl) RotateConditions(actor string, campaignID string) (*deposit.CDA, error) {
+	if campaignID != "" {
+		if _, err := adc.AccCtrl.Campaign(campaignID); err != nil {
+			return nil, err
+		}
+	}
+	cda, err := adc.AccCtrl.RotateConditions(campaignID)
+	if err != nil {
+		adc.logger.Error("forced deposit address rotation failed", "actor", actor, "campaign", campaignID, "err", err)
+		return nil, err
+	}
+	adc.logger.Info("forced deposit address rotation", "actor", actor, "campaign", campaignID, "address", cda.Address)
+	return cda, nil
+}
+
+// PendingTransfers returns the outgoing transfers of the account which aren't confirmed yet.
+func (adc *AdminCtrl) PendingTransfers() ([]*PendingTransfer, error) {
+	pending, err := adc.AccCtrl.store.GetPendingTransfers(adc.AccCtrl.Acc.ID())
+	if err != nil {
+		return nil, err
+	}
+	transfers := make([]*PendingTransfer, 0, len(pending))
+	for originTail, pt := range pending {
+		bndl, err := store.PendingTransferToBundle(pt)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to decode pending transfer %s", originTail)
+		}
+		transfers = append(transfers, &PendingTransfer{
+			OriginTail: originTail, BundleHash: bndl[0].Bundle, Tails: pt.Tails, Recipients: recipients(bndl),
+		})
+	}
+	sort.Slice(transfers, func(i, j int) bool {
+		return transfers[i].OriginTail < transfers[j].OriginTail
+	})
+	return transfers, nil
+}
+
+// recipients returns the outputs of the given bundle.
+func recipients(bndl bundle.Bundle) []account.Recipient {
+	recs := []account.Recipient{}
+	for i := range bndl {
+		if bndl[i].Value > 0 {
+			recs = append(recs, account.Recipient{Address: bndl[i].Address, Value: uint64(bndl[i].Value)})
+		}
+	}
+	return recs
+}
+
+// Payout sends the given amount of iotas to the given address.
+func (adc *AdminCtrl) Payout(actor string, address string, value uint64) (bundle.Bundle, error) {
+	if err := checkAddress(address); err != nil {
+		return nil, err
+	}
+	if value == 0 {
+		return nil, errors.Wrap(ErrInvalidPayout, "value must be greater than zero")
+	}
+	adc.logger.Info("sending payout", "actor", actor, "address", address, "value", value)
+	bndl, err := adc.AccCtrl.Acc.Send(account.Recipient{Address: address, Value: value})
+	if err != nil {
+		adc.logger.Error("payout failed", "actor", actor, "address", address, "value", value, "err", err)
+		return nil, err
+	}
+	adc.logger.Info("sent payout", "actor", actor, "bundle", bndl[0].Bundle, "tail", bndl[0].Hash)
+	return bndl, nil
+}
+
+// Plugins returns the state of the account's plugins.
+func (adc *AdminCtrl) Plugins() []*PluginState {
+	states := make([]*PluginState, len(adc.AccCtrl.plugins))
+	for i, plugin := range adc.AccCtrl.plugins {
+		states[i] = &PluginState{Name: plugin.Name(), Paused: plugin.Paused()}
+	}
+	return states
+}
+
+func (adc *AdminCtrl) plugin(name string) (*ManagedPlugin, error) {
+	for _, plugin := range adc.AccCtrl.plugins {
+		if plugin.Name() == name {
+			return plugin, nil
+		}
+	}
+	return nil, errors.Wrapf(ErrPluginNotFound, "'%s'", name)
+}
+
+// PausePlugin pauses the plugin with the given name.
+func (adc *AdminCtrl) PausePlugin(actor string, name string) error {
+	plugin, err := adc.plugin(name)
+	if err != nil {
+		return err
+	}
+	if err := plugin.Pause(); err != nil {
+		adc.logger.Error("unable to pause plugin", "actor", actor, "plugin", name, "err", err)
+		return err
+	}
+	adc.logger.Info("paused plugin", "actor", actor, "plugin", name)
+	return nil
+}
+
+// ResumePlugin resumes the plugin with the given name.
+func (adc *AdminCtrl) ResumePlugin(actor string, name string) error {
+	plugin, err := adc.plugin(name)
+	if err != nil {
+		return err
+	}
+	if err := plugin.Resume(); err != nil {
+		adc.logger.Error("unable to resume plugin", "actor", actor, "plugin", name, "err", err)
+		return err
+	}
+	adc.logger.Info("resumed plugin", "actor", actor, "plugin", name)
+	return nil
+}
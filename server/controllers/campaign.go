@@ -0,0 +1,58 @@
+package controllers
+
+import (
+	"github.com/luca-moser/donapoc/server/server/config"
+	"github.com/pkg/errors"
+)
+
+// checkCampaigns ensures that every configured campaign has a unique id.
+func (ac *AccCtrl) checkCampaigns() error {
+	seen := map[string]struct{}{}
+	for _, campaign := range ac.Config.App.Account.Campaigns {
+		if campaign.ID == "" {
+			return errors.Wrap(ErrInvalidCampaign, "campaign without id")
+		}
+		if _, ok := seen[campaign.ID]; ok {
+			return errors.Wrapf(ErrInvalidCampaign, "duplicate campaign id '%s'", campaign.ID)
+		}
+		seen[campaign.ID] = struct{}{}
+	}
+	return nil
+}
+
+// Campaigns returns a copy of all configured campaigns, as their settings are reloaded at runtime.
+func (ac *AccCtrl) Campaigns() []config.CampaignConfig {
+	ac.reloadMu.RLock()
+	defer ac.reloadMu.RUnlock()
+	campaigns := make([]config.CampaignConfig, len(ac.Config.App.Account.Campaigns))
+	copy(campaigns, ac.Config.App.Account.Campaigns)
+	return campaigns
+}
+
+// Campaign returns a copy of the campaign with the given id.
+func (ac *AccCtrl) Campaign(id string) (*config.CampaignConfig, error) {
+	ac.reloadMu.RLock()
+	defer ac.reloadMu.RUnlock()
+	return ac.campaign(id)
+}
+
+// campaign returns a copy of the campaign with the given id, the caller must hold the reload lock.
+func (ac *AccCtrl) campaign(id string) (*config.CampaignConfig, error) {
+	for _, campaign := range ac.Config.App.Account.Campaigns {
+		if campaign.ID == id {
+			return &campaign, nil
+		}
+	}
+	return nil, errors.Wrapf(ErrCampaignNotFound, "'%s'", id)
+}
+
+// addressValidityDays returns the validity of the shared deposit address of the given campaign,
+// falling back to the account wide setting.
+func (ac *AccCtrl) addressValidityDays(campaignID string) uint64 {
+	ac.reloadMu.RLock()
+	defer ac.reloadMu.RUnlock()
+	if campaign, err := ac.campaign(campaignID); err == nil && campaign.AddressValidityTimeoutDays != 0 {
+		return campaign.AddressValidityTimeoutDays
+	}
+	return ac.Config.App.Account.AddressValidityTimeoutDays
+}
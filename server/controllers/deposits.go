@@ -0,0 +1,178 @@
+package controllers
+
+import (
+	"github.com/iotaledger/iota.go/consts"
+	"github.com/luca-moser/donapoc/server/storage"
+	"github.com/pkg/errors"
+	"sort"
+	"time"
+)
+
+// the status of a deposit request
+const (
+	DepositRequestOpen      = "open"
+	DepositRequestExpired   = "expired"
+	DepositRequestFulfilled = "fulfilled"
+)
+
+// the maximum amount of addresses of which the balances are queried at once
+const balancesChunkSize = 500
+
+var ErrInvalidDepositRequestStatus = errors.New("invalid deposit request status")
+
+// DepositRequest is a deposit address allocated by the account together with the funds it received.
+type DepositRequest struct {
+	Address        string     `json:"address"`
+	TimeoutAt      *time.Time `json:"timeout_at"`
+	MultiUse       bool       `json:"multi_use"`
+	ExpectedAmount *uint64    `json:"expected_amount,omitempty"`
+	Status         string     `json:"status"`
+	// whether the account still watches the address, addresses are no longer watched once swept
+	Watched  bool    `json:"watched"`
+	KeyIndex *uint64 `json:"key_index,omitempty"`
+	// the campaign and rotation state if the address was handed out by the server,
+	// visitor sessions aren't exposed
+	Campaign   string `json:"campaign,omitempty"`
+	PerVisitor bool   `json:"per_visitor,omitempty"`
+	Current    bool   `json:"current,omitempty"`
+	Next       bool   `json:"next,omitempty"`
+	// confirmed and not yet confirmed donations to the address as recorded in the ledger
+	Received  uint64 `json:"received"`
+	Receiving uint64 `json:"receiving"`
+	Donations int    `json:"donations"`
+	// the value of the donations which were first seen after the address expired
+	Late uint64 `json:"late"`
+	// the current balance of the address on the tangle
+	Balance uint64 `json:"balance"`
+}
+
+func (dr *DepositRequest) updateStatus(now time.Time) {
+	switch {
+	case dr.ExpectedAmount != nil && *dr.ExpectedAmount > 0 && dr.Received >= *dr.ExpectedAmount:
+		dr.Status = DepositRequestFulfilled
+	case (dr.ExpectedAmount == nil || *dr.ExpectedAmount == 0) && !dr.MultiUse && dr.Received > 0:
+		dr.Status = DepositRequestFulfilled
+	case dr.TimeoutAt != nil && dr.TimeoutAt.Before(now):
+		dr.Status = DepositRequestExpired
+	default:
+		dr.Status = DepositRequestOpen
+	}
+}
+
+// DepositRequests returns all deposit addresses known to the account store or handed out by the server,
+// newest timeout first. An empty status includes all of them.
+func (lc *LedgerCtrl) DepositRequests(status string) ([]*DepositRequest, error) {
+	switch status {
+	case "", DepositRequestOpen, DepositRequestExpired, DepositRequestFulfilled:
+	default:
+		return nil, errors.Wrapf(ErrInvalidDepositRequestStatus, "'%s'", status)
+	}
+	ac := lc.AccCtrl
+
+	// keyed by the address without checksum
+	reqs := map[string]*DepositRequest{}
+	recs, err := ac.srvStore.CDAs(ac.Acc.ID())
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to load deposit addresses")
+	}
+	for _, rec := range recs {
+		reqs[rec.ID] = &DepositRequest{
+			Address: rec.Address, TimeoutAt: rec.TimeoutAt, MultiUse: rec.MultiUse, ExpectedAmount: rec.ExpectedAmount,
+			Campaign: rec.Campaign, PerVisitor: rec.Session != "", Current: rec.Current, Next: rec.Next,
+		}
+	}
+
+	state, err := ac.store.LoadAccount(ac.Acc.ID())
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to load account state")
+	}
+	for keyIndex, stored := range state.DepositAddresses {
+		address, err := ac.addrGen(keyIndex, stored.SecurityLevel, true)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to generate deposit address of key index %d", keyIndex)
+		}
+		keyIndex := keyIndex
+		req, ok := reqs[address[:consts.HashTrytesSize]]
+		if !ok {
+			req = &DepositRequest{
+				Address: address, TimeoutAt: stored.TimeoutAt, MultiUse: stored.MultiUse, ExpectedAmount: stored.ExpectedAmount,
+			}
+			reqs[address[:consts.HashTrytesSize]] = req
+		}
+		req.Watched = true
+		req.KeyIndex = &keyIndex
+	}
+
+	donations, _, err := lc.Donations(&storage.DonationQuery{})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to load donations")
+	}
+	for _, d := range donations {
+		req, ok := reqs[d.Address[:consts.HashTrytesSize]]
+		if !ok {
+			continue
+		}
+		if d.Value > 0 {
+			req.Donations++
+		}
+		if d.Received() {
+			req.Received += d.Value
+		} else {
+			req.Receiving += d.Value
+		}
+		if req.TimeoutAt != nil && d.ReceivingAt.After(*req.TimeoutAt) {
+			req.Late += d.Value
+		}
+	}
+
+	list := make([]*DepositRequest, 0, len(reqs))
+	for _, req := range reqs {
+		list = append(list, req)
+	}
+	if err := lc.fillBalances(list); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	filtered := list[:0]
+	for _, req := range list {
+		req.updateStatus(now)
+		if status == "" || req.Status == status {
+			filtered = append(filtered, req)
+		}
+	}
+	sort.Slice(filtered, func(i, j int) bool {
+		a, b := filtered[i].TimeoutAt, filtered[j].TimeoutAt
+		if a == nil || b == nil {
+			return b == nil && a != nil
+		}
+		return a.After(*b)
+	})
+	return filtered, nil
+}
+
+// fillBalances queries the current balances of the given deposit addresses
+// in chunks, as nodes limit the amount of addresses per request.
+func (lc *LedgerCtrl) fillBalances(reqs []*DepositRequest) error {
+	iotaAPI := lc.AccCtrl.api()
+	for start := 0; start < len(reqs); start += balancesChunkSize {
+		chunk := reqs[start:]
+		if len(chunk) > balancesChunkSize {
+			chunk = chunk[:balancesChunkSize]
+		}
+		addrs := make([]string, len(chunk))
+		for i, req := range chunk {
+			addrs[i] = req.Address[:consts.HashTrytesSize]
+		}
+		balances, err := iotaAPI.GetBalances(addrs, 100)
+		if err != nil {
+			return errors.Wrap(err, "unable to query balances of deposit addresses")
+		}
+		for i, balance := range balances.Balances {
+			if i < len(chunk) {
+				chunk[i].Balance = balance
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package controllers
+
+import (
+	"context"
+	"github.com/iotaledger/iota.go/account/event"
+	"github.com/luca-moser/donapoc/server/storage"
+	"github.com/luca-moser/donapoc/server/utilities"
+	"github.com/pkg/errors"
+	"gopkg.in/inconshreveable/log15.v2"
+	"sync"
+	"time"
+)
+
+// emitted through the account's event machine with the *GoalProgress as payload
+const (
+	// whenever a donation to the account was recorded
+	EventGoalProgress event.Event = 301
+	// once when the raised amount reaches the target
+	EventGoalReached event.Event = 302
+)
+
+var ErrInvalidGoal = errors.New("invalid goal")
+var ErrGoalNotSet = errors.New("no goal set")
+
+// GoalProgress is the progress of the account towards its fundraising goal.
+type GoalProgress struct {
+	Target      uint64     `json:"target"`
+	Deadline    *time.Time `json:"deadline,omitempty"`
+	Description string     `json:"description"`
+	// the sum of the received (confirmed) donations
+	Raised uint64 `json:"raised"`
+	// the sum of the not yet confirmed donations
+	Pending uint64  `json:"pending"`
+	Percent float64 `json:"percent"`
+	// the count of received donations, as donors are anonymous every donation counts as one donor
+	Donors  int64 `json:"donors"`
+	Reached bool  `json:"reached"`
+	// whether the deadline passed
+	Expired bool `json:"expired"`
+}
+
+// GoalCtrl tracks the progress of the account towards the configured fundraising goal.
+type GoalCtrl struct {
+	AccCtrl    *AccCtrl    `inject:""`
+	LedgerCtrl *LedgerCtrl `inject:""`
+	logger     log15.Logger
+	deadline   *time.Time
+	mu         sync.Mutex
+	reached    bool
+	notify     chan struct{}
+	exit       chan struct{}
+	done       chan struct{}
+}
+
+func (gc *GoalCtrl) Init() error {
+	logger, _ := utilities.GetLogger("goal")
+	gc.logger = logger
+
+	conf := gc.AccCtrl.Config.App.Account.Goal
+	if conf.Target == 0 {
+		return nil
+	}
+	if conf.Deadline != "" {
+		deadline, err := time.Parse(time.RFC3339, conf.Deadline)
+		if err != nil {
+			return errors.Wrap(ErrInvalidGoal, "deadline must be a RFC3339 timestamp")
+		}
+		gc.deadline = &deadline
+	}
+
+	// the goal might have been reached before the restart
+	progress, err := gc.Progress()
+	if err != nil {
+		return errors.Wrap(err, "unable to compute goal progress")
+	}
+	gc.reached = progress.Reached
+	if gc.reached && conf.StopWhenReached {
+		gc.AccCtrl.CloseDonations()
+	}
+
+	gc.notify = make(chan struct{}, 1)
+	gc.exit = make(chan struct{})
+	gc.done = make(chan struct{})
+	gc.LedgerCtrl.OnRecorded(func(d *storage.Donation) {
+		// coalesce notifications while the progress is being computed
+		select {
+		case gc.notify <- struct{}{}:
+		default:
+		}
+	})
+	go gc.run()
+	logger.Info("goal enabled", "target", conf.Target, "raised", progress.Raised, "reached", progress.Reached)
+	return nil
+}
+
+// Enabled tells whether a goal is configured.
+func (gc *GoalCtrl) Enabled() bool {
+	return gc.AccCtrl.Config.App.Account.Goal.Target != 0
+}
+
+func (gc *GoalCtrl) run() {
+	defer close(gc.done)
+	for {
+		select {
+		case <-gc.notify:
+		case <-gc.exit:
+			return
+		}
+		progress, err := gc.Progress()
+		if err != nil {
+			gc.logger.Error("unable to compute goal progress", "err", err)
+			continue
+		}
+		gc.AccCtrl.EM.Emit(progress, EventGoalProgress)
+
+		gc.mu.Lock()
+		justReached := progress.Reached && !gc.reached
+		gc.reached = progress.Reached
+		gc.mu.Unlock()
+		if !justReached {
+			continue
+		}
+		gc.logger.Info("goal reached", "target", progress.Target, "raised", progress.Raised, "donors", progress.Donors)
+		if gc.AccCtrl.Config.App.Account.Goal.StopWhenReached {
+			gc.AccCtrl.CloseDonations()
+			gc.logger.Info("stopped handing out donation links")
+		}
+		gc.AccCtrl.EM.Emit(progress, EventGoalReached)
+	}
+}
+
+// Progress computes the progress towards the goal from the donations in the ledger.
+func (gc *GoalCtrl) Progress() (*GoalProgress, error) {
+	conf := gc.AccCtrl.Config.App.Account.Goal
+	if conf.Target == 0 {
+		return nil, ErrGoalNotSet
+	}
+	donations, _, err := gc.LedgerCtrl.Donations(&storage.DonationQuery{})
+	if err != nil {
+		return nil, err
+	}
+	progress := &GoalProgress{Target: conf.Target, Deadline: gc.deadline, Description: conf.Description}
+	for _, d := range donations {
+		if !d.Received() {
+			progress.Pending += d.Value
+			continue
+		}
+		progress.Raised += d.Value
+		if d.Value > 0 {
+			progress.Donors++
+		}
+	}
+	progress.Percent = float64(progress.Raised) / float64(progress.Target) * 100
+	progress.Reached = progress.Raised >= progress.Target
+	progress.Expired = gc.deadline != nil && time.Now().After(*gc.deadline)
+	return progress, nil
+}
+
+// Shutdown stops tracking the goal. It must be shut down before the ledger.
+func (gc *GoalCtrl) Shutdown(ctx context.Context) error {
+	if gc.exit == nil {
+		return nil
+	}
+	close(gc.exit)
+	select {
+	case <-gc.done:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "goal tracker did not stop in time")
+	}
+}
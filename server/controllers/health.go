@@ -0,0 +1,202 @@
+package controllers
+
+import (
+	"fmt"
+	"github.com/iotaledger/iota.go/account/timesrc"
+	"github.com/iotaledger/iota.go/api"
+	"github.com/luca-moser/donapoc/server/server/config"
+	"github.com/pkg/errors"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const defaultHealthCheckTimeout = time.Duration(5) * time.Second
+
+// how long the outcome of the readiness checks is served before they are run again
+const readinessCacheTTL = time.Duration(5) * time.Second
+
+// CheckResult is the outcome of a single readiness check.
+type CheckResult struct {
+	Name    string  `json:"name"`
+	OK      bool    `json:"ok"`
+	Latency float64 `json:"latency_ms"`
+	Error   string  `json:"error,omitempty"`
+	// check specific details, e.g. the state of each node
+	Details interface{} `json:"details,omitempty"`
+}
+
+// Readiness is the outcome of all readiness checks.
+type Readiness struct {
+	Ready     bool           `json:"ready"`
+	Checks    []*CheckResult `json:"checks"`
+	CheckedAt time.Time      `json:"checked_at"`
+}
+
+// NodeState is the state of a node of the quorum as seen by the readiness check.
+type NodeState struct {
+	URI                                string `json:"uri"`
+	Reachable                          bool   `json:"reachable"`
+	Synced                             bool   `json:"synced"`
+	LatestMilestoneIndex               int64  `json:"latest_milestone_index,omitempty"`
+	LatestSolidSubtangleMilestoneIndex int64  `json:"latest_solid_subtangle_milestone_index,omitempty"`
+	Error                              string `json:"error,omitempty"`
+}
+
+// HealthCtrl checks whether the server is able to serve donations.
+type HealthCtrl struct {
+	Config  *config.Configuration `inject:""`
+	AccCtrl *AccCtrl              `inject:""`
+	// guards the last readiness and serializes the runs of the checks
+	mu   sync.Mutex
+	last *Readiness
+}
+
+func (hc *HealthCtrl) Init() error {
+	return nil
+}
+
+type check struct {
+	name string
+	fn   func() (interface{}, error)
+}
+
+// Readiness returns the outcome of the readiness checks. The server is ready if all of them pass.
+// The outcome is cached for a few seconds and concurrent callers share a single run of the checks,
+// so that frequent probes don't flood the nodes and the NTP server with queries.
+func (hc *HealthCtrl) Readiness() *Readiness {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	if hc.last != nil && time.Since(hc.last.CheckedAt) < readinessCacheTTL {
+		return hc.last
+	}
+	hc.last = hc.runChecks()
+	return hc.last
+}
+
+// runChecks runs all readiness checks concurrently.
+func (hc *HealthCtrl) runChecks() *Readiness {
+	checks := []check{
+		{"account", hc.checkAccount},
+		{"store", hc.checkStore},
+		{"quorum", hc.checkQuorum},
+		{"ntp", hc.checkNTP},
+	}
+	readiness := &Readiness{Ready: true, Checks: make([]*CheckResult, len(checks))}
+	var wg sync.WaitGroup
+	wg.Add(len(checks))
+	for i, c := range checks {
+		go func(i int, c check) {
+			defer wg.Done()
+			readiness.Checks[i] = runCheck(c)
+		}(i, c)
+	}
+	wg.Wait()
+	for _, result := range readiness.Checks {
+		readiness.Ready = readiness.Ready && result.OK
+	}
+	readiness.CheckedAt = time.Now()
+	return readiness
+}
+
+func runCheck(c check) *CheckResult {
+	start := time.Now()
+	result := &CheckResult{Name: c.name}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		details, err := c.fn()
+		result.Details = details
+		if err != nil {
+			result.Error = err.Error()
+			return
+		}
+		result.OK = true
+	}()
+	select {
+	case <-done:
+		result.Latency = float64(time.Since(start)) / float64(time.Millisecond)
+		return result
+	case <-time.After(defaultHealthCheckTimeout):
+		return &CheckResult{
+			Name: c.name, Latency: float64(time.Since(start)) / float64(time.Millisecond),
+			Error: fmt.Sprintf("check timed out after %s", defaultHealthCheckTimeout),
+		}
+	}
+}
+
+func (hc *HealthCtrl) checkAccount() (interface{}, error) {
+	if !hc.AccCtrl.Running() {
+		return nil, errors.New("account is not running")
+	}
+	return nil, nil
+}
+
+func (hc *HealthCtrl) checkStore() (interface{}, error) {
+	if err := hc.AccCtrl.srvStore.Ping(); err != nil {
+		return nil, errors.Wrapf(err, "%s store is not reachable", hc.AccCtrl.StoreBackend())
+	}
+	return nil, nil
+}
+
+// checkQuorum queries the node info of every node of the quorum. Passes if at least
+// the quorum threshold of the nodes is reachable and synced.
+func (hc *HealthCtrl) checkQuorum() (interface{}, error) {
+	quorumConf := hc.AccCtrl.QuorumConfig()
+	timeout := defaultHealthCheckTimeout
+	if quorumConf.Timeout != 0 && time.Duration(quorumConf.Timeout)*time.Second < timeout {
+		timeout = time.Duration(quorumConf.Timeout) * time.Second
+	}
+	httpClient := &http.Client{Timeout: timeout}
+
+	states := make([]*NodeState, len(quorumConf.Nodes))
+	var wg sync.WaitGroup
+	wg.Add(len(quorumConf.Nodes))
+	for i, node := range quorumConf.Nodes {
+		go func(i int, node string) {
+			defer wg.Done()
+			states[i] = nodeState(node, httpClient, quorumConf.MaxSubtangleMilestoneDelta)
+		}(i, node)
+	}
+	wg.Wait()
+
+	var synced int
+	for _, state := range states {
+		if state.Synced {
+			synced++
+		}
+	}
+	needed := int(math.Ceil(quorumConf.Threshold * float64(len(states))))
+	if synced < needed || synced == 0 {
+		return states, fmt.Errorf("only %d of %d nodes are synced, %d needed", synced, len(states), needed)
+	}
+	return states, nil
+}
+
+func nodeState(node string, httpClient *http.Client, maxDelta uint64) *NodeState {
+	state := &NodeState{URI: node}
+	iotaAPI, err := api.ComposeAPI(api.HTTPClientSettings{URI: node, Client: httpClient})
+	if err != nil {
+		state.Error = err.Error()
+		return state
+	}
+	info, err := iotaAPI.GetNodeInfo()
+	if err != nil {
+		state.Error = err.Error()
+		return state
+	}
+	state.Reachable = true
+	state.LatestMilestoneIndex = info.LatestMilestoneIndex
+	state.LatestSolidSubtangleMilestoneIndex = info.LatestSolidSubtangleMilestoneIndex
+	state.Synced = info.LatestMilestoneIndex-info.LatestSolidSubtangleMilestoneIndex <= int64(maxDelta)
+	return state
+}
+
+func (hc *HealthCtrl) checkNTP() (interface{}, error) {
+	ntpServer := hc.Config.App.Account.Time.NTPServer
+	if _, err := timesrc.NewNTPTimeSource(ntpServer).Time(); err != nil {
+		return nil, errors.Wrapf(err, "NTP server %s does not answer", ntpServer)
+	}
+	return nil, nil
+}
@@ -1,5 +1,21 @@
 package controllers
 
+import (
+	"context"
+	"github.com/luca-moser/donapoc/server/server/config"
+)
+
 type Controller interface {
 	Init() error
 }
+
+// Shutdowner is implemented by components which must release resources on shutdown.
+// Shutdown must return once the given context is done.
+type Shutdowner interface {
+	Shutdown(ctx context.Context) error
+}
+
+// Reloader is implemented by components which apply changes of the config at runtime.
+type Reloader interface {
+	Reload(conf *config.Configuration) error
+}
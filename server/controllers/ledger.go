@@ -0,0 +1,213 @@
+package controllers
+
+import (
+	"github.com/iotaledger/iota.go/account/event/listener"
+	"github.com/iotaledger/iota.go/bundle"
+	"github.com/iotaledger/iota.go/consts"
+	"github.com/luca-moser/donapoc/server/storage"
+	"github.com/luca-moser/donapoc/server/utilities"
+	"github.com/pkg/errors"
+	"gopkg.in/inconshreveable/log15.v2"
+	"sync"
+	"time"
+)
+
+// LedgerCtrl records every deposit received by the account in the donation ledger.
+type LedgerCtrl struct {
+	AccCtrl *AccCtrl `inject:""`
+	logger  log15.Logger
+	hooksMu sync.Mutex
+	hooks   []func(d *storage.Donation)
+}
+
+func (lc *LedgerCtrl) Init() error {
+	logger, _ := utilities.GetLogger("ledger")
+	lc.logger = logger
+
+	lis := listener.NewChannelEventListener(lc.AccCtrl.EM).
+		RegReceivingDeposits().
+		RegReceivedDeposits().
+		RegReceivedMessages().
+		RegAccountShutdown()
+
+	go func() {
+		defer lis.Close()
+		for {
+			select {
+			case bndl := <-lis.ReceivingDeposit:
+				if err := lc.record(bndl, false); err != nil {
+					logger.Error("unable to record receiving deposit", "err", err)
+				}
+			case bndl := <-lis.ReceivedDeposit:
+				if err := lc.record(bndl, true); err != nil {
+					logger.Error("unable to record received deposit", "err", err)
+				}
+			case bndl := <-lis.ReceivedMessage:
+				// messages are only announced once, they don't transfer any value awaiting confirmation
+				if err := lc.record(bndl, true); err != nil {
+					logger.Error("unable to record received message", "err", err)
+				}
+			case <-lis.Shutdown:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// record adds the given deposit bundle to the ledger or updates its existing entry.
+func (lc *LedgerCtrl) record(bndl bundle.Bundle, received bool) error {
+	if len(bndl) == 0 {
+		return nil
+	}
+	srvStore := lc.AccCtrl.srvStore
+	tail := bndl[0]
+	now := time.Now()
+
+	d, err := srvStore.Donation(tail.Bundle)
+	if err != nil {
+		return err
+	}
+	if d == nil {
+		d, err = lc.newDonation(bndl)
+		if err != nil {
+			return err
+		}
+		if d == nil {
+			// the bundle doesn't deposit to any address handed out by the server
+			return nil
+		}
+		d.ReceivingAt = now
+	}
+
+	if received {
+		if d.Received() {
+			return nil
+		}
+		d.Tail = tail.Hash
+		d.ReceivedAt = &now
+	}
+
+	if err := srvStore.SaveDonation(d); err != nil {
+		return errors.Wrapf(err, "unable to save donation %s", d.ID)
+	}
+	lc.logger.Info("recorded donation", "bundle", d.BundleHash, "value", d.Value, "received", received)
+
+	lc.hooksMu.Lock()
+	defer lc.hooksMu.Unlock()
+	for _, hook := range lc.hooks {
+		hook(d)
+	}
+	return nil
+}
+
+// OnRecorded registers a callback which is called with every donation after it was recorded.
+// The callback runs within the ledger's event loop, it must therefore neither block
+// nor emit events through the account's event machine.
+func (lc *LedgerCtrl) OnRecorded(hook func(d *storage.Donation)) {
+	lc.hooksMu.Lock()
+	defer lc.hooksMu.Unlock()
+	lc.hooks = append(lc.hooks, hook)
+}
+
+// newDonation creates a donation from the transactions of the bundle which deposit
+// to addresses handed out by the server. Returns nil if there are none. Bundles without
+// any value yield a donation without value holding the message sent to the address.
+func (lc *LedgerCtrl) newDonation(bndl bundle.Bundle) (*storage.Donation, error) {
+	message := !isValueBundle(bndl)
+	var d *storage.Donation
+	for i := range bndl {
+		tx := &bndl[i]
+		if tx.Value < 0 || (tx.Value == 0 && !message) {
+			continue
+		}
+		if message && d != nil {
+			break
+		}
+		cda, err := lc.AccCtrl.srvStore.CDA(tx.Address[:consts.HashTrytesSize])
+		if err != nil {
+			return nil, err
+		}
+		if cda == nil {
+			continue
+		}
+		if d == nil {
+			d = &storage.Donation{
+				ID: tx.Bundle, AccountID: lc.AccCtrl.Acc.ID(), BundleHash: tx.Bundle, Tail: bndl[0].Hash,
+				Address: cda.Address, CDA: storage.NewDonationCDA(cda), Campaign: cda.Campaign,
+			}
+			d.Message, d.Tag = DecodeBundleMessage(bndl, tx.Address)
+		}
+		d.Value += uint64(tx.Value)
+	}
+	return d, nil
+}
+
+func isValueBundle(bndl bundle.Bundle) bool {
+	for i := range bndl {
+		if bndl[i].Value != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Donations returns the donations of the account matching the given query.
+func (lc *LedgerCtrl) Donations(q *storage.DonationQuery) ([]*storage.Donation, int64, error) {
+	return lc.AccCtrl.srvStore.Donations(lc.AccCtrl.Acc.ID(), q)
+}
+
+// DonorWallEntry is a publicly listed donation.
+type DonorWallEntry struct {
+	Value      uint64    `json:"value"`
+	Message    string    `json:"message"`
+	Tag        string    `json:"tag"`
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+// DonorWall returns the most recent received donations with their messages cut to the given length.
+// Messages are sanitized but not escaped, they must be rendered as text.
+func (lc *LedgerCtrl) DonorWall(limit int64, messageLength int) ([]*DonorWallEntry, error) {
+	minValue := uint64(1)
+	donations, _, err := lc.Donations(&storage.DonationQuery{ReceivedOnly: true, MinValue: &minValue, Limit: limit})
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*DonorWallEntry, len(donations))
+	for i, d := range donations {
+		entries[i] = &DonorWallEntry{
+			Value:      d.Value,
+			Message:    TruncateMessage(d.Message, messageLength),
+			Tag:        d.Tag,
+			ReceivedAt: *d.ReceivedAt,
+		}
+	}
+	return entries, nil
+}
+
+// CampaignBalance is the sum of the donations attributed to a campaign.
+type CampaignBalance struct {
+	// confirmed donations
+	Received uint64 `json:"received"`
+	// not yet confirmed donations
+	Receiving uint64 `json:"receiving"`
+	Donations int64  `json:"donations"`
+}
+
+// CampaignBalance sums up the donations attributed to the given campaign.
+func (lc *LedgerCtrl) CampaignBalance(campaignID string) (*CampaignBalance, error) {
+	minValue := uint64(1)
+	donations, total, err := lc.Donations(&storage.DonationQuery{Campaign: &campaignID, MinValue: &minValue})
+	if err != nil {
+		return nil, err
+	}
+	balance := &CampaignBalance{Donations: total}
+	for _, d := range donations {
+		if d.Received() {
+			balance.Received += d.Value
+			continue
+		}
+		balance.Receiving += d.Value
+	}
+	return balance, nil
+}
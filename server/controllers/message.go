@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"github.com/iotaledger/iota.go/bundle"
+	"github.com/iotaledger/iota.go/converter"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maximum length in runes of a donor message kept in the ledger, a message of a single transaction
+// holds up to 1093 characters
+const maxMessageLength = 4000
+
+// DecodeBundleMessage decodes the message and tag a donor attached to the output of the given bundle
+// which goes to the given address (without checksum). A message which doesn't fit into a single transaction
+// continues in the subsequent zero value transactions to the same address, therefore only this contiguous run
+// of transactions is decoded and neither messages to other recipients nor signatures of inputs end up in the message.
+func DecodeBundleMessage(bndl bundle.Bundle, address string) (msg string, tag string) {
+	start := -1
+	for i := range bndl {
+		if bndl[i].Address == address && bndl[i].Value >= 0 {
+			start = i
+			break
+		}
+	}
+	if start == -1 {
+		return "", ""
+	}
+
+	var fragments strings.Builder
+	fragments.WriteString(bndl[start].SignatureMessageFragment)
+	for i := start + 1; i < len(bndl) && bndl[i].Address == address && bndl[i].Value == 0; i++ {
+		fragments.WriteString(bndl[i].SignatureMessageFragment)
+	}
+	return decodeMessage(fragments.String()), strings.TrimRight(bndl[start].Tag, "9")
+}
+
+// decodeMessage decodes the ASCII message encoded in the given trytes and sanitizes it.
+func decodeMessage(trytes string) string {
+	trytes = strings.TrimRight(trytes, "9")
+	if len(trytes)%2 != 0 {
+		trytes += "9"
+	}
+	raw, err := converter.TrytesToASCII(trytes)
+	if err != nil {
+		return ""
+	}
+	return sanitizeMessage(raw, maxMessageLength)
+}
+
+// sanitizeMessage drops invalid UTF-8 and control characters (except newlines)
+// and cuts the message to the given amount of runes.
+func sanitizeMessage(raw string, maxLength int) string {
+	var b strings.Builder
+	var runes int
+	for len(raw) > 0 && runes < maxLength {
+		r, size := utf8.DecodeRuneInString(raw)
+		raw = raw[size:]
+		if r == utf8.RuneError || (unicode.IsControl(r) && r != '\n') {
+			continue
+		}
+		b.WriteRune(r)
+		runes++
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// TruncateMessage cuts the message to the given amount of runes, marking cut messages with an ellipsis.
+func TruncateMessage(msg string, maxLength int) string {
+	if utf8.RuneCountInString(msg) <= maxLength {
+		return msg
+	}
+	return string([]rune(msg)[:maxLength]) + "…"
+}
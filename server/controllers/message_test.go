@@ -0,0 +1,135 @@
+package controllers
+
+import (
+	"github.com/iotaledger/iota.go/bundle"
+	"github.com/iotaledger/iota.go/consts"
+	"github.com/iotaledger/iota.go/converter"
+	"github.com/iotaledger/iota.go/transaction"
+	"strings"
+	"testing"
+)
+
+var (
+	cdaAddr   = strings.Repeat("A", consts.HashTrytesSize)
+	otherAddr = strings.Repeat("B", consts.HashTrytesSize)
+	inputAddr = strings.Repeat("C", consts.HashTrytesSize)
+)
+
+// fragments encodes the given message into signature message fragments.
+func fragments(t *testing.T, msg string) []string {
+	trytes, err := converter.ASCIIToTrytes(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frags := []string{}
+	for len(trytes) > consts.SignatureMessageFragmentSizeInTrytes {
+		frags = append(frags, trytes[:consts.SignatureMessageFragmentSizeInTrytes])
+		trytes = trytes[consts.SignatureMessageFragmentSizeInTrytes:]
+	}
+	return append(frags, trytes+strings.Repeat("9", consts.SignatureMessageFragmentSizeInTrytes-len(trytes)))
+}
+
+// output creates the transactions of an output with the given message.
+func output(t *testing.T, address string, value int64, tag string, msg string) []transaction.Transaction {
+	txs := []transaction.Transaction{}
+	for i, frag := range fragments(t, msg) {
+		tx := transaction.Transaction{Address: address, Tag: tag, SignatureMessageFragment: frag}
+		if i == 0 {
+			tx.Value = value
+		}
+		txs = append(txs, tx)
+	}
+	return txs
+}
+
+// input creates the transactions of an input whose signature spans two fragments.
+func input(value int64) []transaction.Transaction {
+	sig := strings.Repeat("SIGNATURE", consts.SignatureMessageFragmentSizeInTrytes/9)
+	return []transaction.Transaction{
+		{Address: inputAddr, Value: -value, SignatureMessageFragment: sig},
+		{Address: inputAddr, SignatureMessageFragment: sig},
+	}
+}
+
+func newBundle(parts ...[]transaction.Transaction) bundle.Bundle {
+	bndl := bundle.Bundle{}
+	for _, part := range parts {
+		bndl = append(bndl, part...)
+	}
+	return bndl
+}
+
+func TestDecodeBundleMessage(t *testing.T) {
+	long := strings.Repeat("thanks for the article! ", 60)
+	tests := []struct {
+		name string
+		bndl bundle.Bundle
+		msg  string
+		tag  string
+	}{
+		{
+			name: "single fragment",
+			bndl: newBundle(output(t, cdaAddr, 100, "DONOR9999", "thanks!"), input(100)),
+			msg:  "thanks!", tag: "DONOR",
+		},
+		{
+			name: "multi fragment",
+			bndl: newBundle(output(t, cdaAddr, 100, "DONOR", long), input(100)),
+			msg:  strings.TrimSpace(long), tag: "DONOR",
+		},
+		{
+			name: "multi recipient",
+			bndl: newBundle(
+				output(t, otherAddr, 50, "OTHER", "not for you"),
+				output(t, cdaAddr, 100, "DONOR", "for you"),
+				output(t, otherAddr, 50, "OTHER", "not for you either"),
+				input(200),
+			),
+			msg: "for you", tag: "DONOR",
+		},
+		{
+			name: "message without value",
+			bndl: newBundle(output(t, cdaAddr, 0, "DONOR", "hello")),
+			msg:  "hello", tag: "DONOR",
+		},
+		{
+			name: "address not in bundle",
+			bndl: newBundle(output(t, otherAddr, 100, "OTHER", "not for you"), input(100)),
+		},
+		{
+			name: "address only used as input",
+			bndl: newBundle(output(t, otherAddr, 100, "OTHER", "not for you"), []transaction.Transaction{
+				{Address: cdaAddr, Value: -100, SignatureMessageFragment: strings.Repeat("SIGNATURE", 243)},
+			}),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			msg, tag := DecodeBundleMessage(test.bndl, cdaAddr)
+			if msg != test.msg {
+				t.Errorf("expected message '%s', got '%s'", test.msg, msg)
+			}
+			if tag != test.tag {
+				t.Errorf("expected tag '%s', got '%s'", test.tag, tag)
+			}
+		})
+	}
+}
+
+func TestSanitizeMessage(t *testing.T) {
+	tests := []struct {
+		raw       string
+		maxLength int
+		expected  string
+	}{
+		{raw: "hello\x00\x07 world\n", maxLength: 100, expected: "hello world"},
+		{raw: "line 1\nline 2", maxLength: 100, expected: "line 1\nline 2"},
+		{raw: "abc\xffdef", maxLength: 100, expected: "abcdef"},
+		{raw: "abcdef", maxLength: 3, expected: "abc"},
+	}
+	for _, test := range tests {
+		if msg := sanitizeMessage(test.raw, test.maxLength); msg != test.expected {
+			t.Errorf("sanitizing %q: expected %q, got %q", test.raw, test.expected, msg)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"github.com/iotaledger/iota.go/account"
+	"github.com/iotaledger/iota.go/account/event"
+	"github.com/iotaledger/iota.go/account/plugins/promoter"
+	"github.com/iotaledger/iota.go/account/plugins/transfer/poller"
+	"github.com/luca-moser/donapoc/server/metrics"
+	"github.com/luca-moser/donapoc/server/server/config"
+	"github.com/luca-moser/donapoc/server/utilities"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+)
+
+// metric label values of the account events
+var eventNames = map[event.Event]string{
+	event.EventSentTransfer:                 "sent_transfer",
+	event.EventDoingInputSelection:          "input_selection",
+	event.EventPreparingTransfer:            "preparing_transfer",
+	event.EventGettingTransactionsToApprove: "getting_transactions_to_approve",
+	event.EventAttachingToTangle:            "attaching_to_tangle",
+	event.EventError:                        "internal_error",
+	event.EventShutdown:                     "shutdown",
+	poller.EventTransferConfirmed:           "transfer_confirmed",
+	poller.EventReceivingDeposit:            "receiving_deposit",
+	poller.EventReceivedDeposit:             "received_deposit",
+	poller.EventReceivedMessage:             "received_message",
+	promoter.EventPromotion:                 "promotion",
+	promoter.EventReattachment:              "reattachment",
+	EventSweep:                              "sweep",
+	EventGoalProgress:                       "goal_progress",
+	EventGoalReached:                        "goal_reached",
+	EventConditionsRotated:                  "conditions_rotated",
+}
+
+// MetricsCtrl collects the metrics of the main and the tenant accounts, if enabled in the web config.
+type MetricsCtrl struct {
+	Config     *config.Configuration `inject:""`
+	AccCtrl    *AccCtrl              `inject:""`
+	TenantCtrl *TenantCtrl           `inject:""`
+	handler    http.Handler
+}
+
+func (mc *MetricsCtrl) Init() error {
+	if !mc.Config.App.HTTP.Metrics {
+		return nil
+	}
+	logger, _ := utilities.GetLogger("metrics")
+
+	reg := metrics.NewRegistry()
+	reg.MustRegister(metrics.NewBalanceCollector(mc.accounts))
+	for tenant, accCtrl := range mc.accCtrls() {
+		for ev, name := range eventNames {
+			counter := metrics.AccountEvents.WithLabelValues(tenant, name)
+			accCtrl.EM.RegisterListener(func(data interface{}) {
+				counter.Inc()
+			}, ev)
+		}
+	}
+	mc.handler = promhttp.HandlerFor(reg, promhttp.HandlerOpts{})
+	logger.Info("metrics enabled")
+	return nil
+}
+
+// accCtrls returns the controllers of the running accounts by tenant, the main account has an empty tenant id.
+func (mc *MetricsCtrl) accCtrls() map[string]*AccCtrl {
+	accCtrls := map[string]*AccCtrl{"": mc.AccCtrl}
+	for _, tenant := range mc.TenantCtrl.Tenants() {
+		if tenant.Running() {
+			accCtrls[tenant.ID] = tenant.AccCtrl
+		}
+	}
+	return accCtrls
+}
+
+func (mc *MetricsCtrl) accounts() map[string]account.Account {
+	accs := map[string]account.Account{}
+	for tenant, accCtrl := range mc.accCtrls() {
+		accs[tenant] = accCtrl.Acc
+	}
+	return accs
+}
+
+// Enabled tells whether metrics are collected.
+func (mc *MetricsCtrl) Enabled() bool {
+	return mc.handler != nil
+}
+
+// Handler returns the HTTP handler exposing the metrics in the Prometheus format.
+func (mc *MetricsCtrl) Handler() http.Handler {
+	return mc.handler
+}
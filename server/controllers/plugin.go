@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"github.com/iotaledger/iota.go/account"
+	"github.com/pkg/errors"
+	"sync"
+)
+
+var ErrPluginNotFound = errors.New("plugin not found")
+
+// ManagedPlugin wraps an account plugin so that it can be paused and resumed while the account is running.
+// As the plugins of the account library can't be restarted once shut down, resuming starts a new instance.
+type ManagedPlugin struct {
+	name    string
+	create  func() account.Plugin
+	mu      sync.Mutex
+	acc     account.Account
+	current account.Plugin
+	started bool
+	paused  bool
+}
+
+// newManagedPlugin creates a ManagedPlugin which uses the given function to create plugin instances.
+func newManagedPlugin(create func() account.Plugin) *ManagedPlugin {
+	first := create()
+	return &ManagedPlugin{name: first.Name(), create: create, current: first}
+}
+
+// Start starts the plugin instance, a new one if the plugin was shut down before, e.g. when the
+// settings of the account are updated. It is a no-op while the plugin is paused.
+func (mp *ManagedPlugin) Start(acc account.Account) error {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	mp.acc = acc
+	mp.started = true
+	if mp.paused {
+		return nil
+	}
+	if mp.current == nil {
+		mp.current = mp.create()
+	}
+	return mp.current.Start(acc)
+}
+
+// setCreate replaces the function creating the plugin instances, taking effect with the next started instance.
+func (mp *ManagedPlugin) setCreate(create func() account.Plugin) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	mp.create = create
+}
+
+// Shutdown shuts down the running plugin instance, it is a no-op while the plugin is paused.
+func (mp *ManagedPlugin) Shutdown() error {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	mp.started = false
+	if mp.current == nil {
+		return nil
+	}
+	err := mp.current.Shutdown()
+	mp.current = nil
+	return err
+}
+
+func (mp *ManagedPlugin) Name() string {
+	return mp.name
+}
+
+// Pause shuts down the running plugin instance.
+func (mp *ManagedPlugin) Pause() error {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	mp.paused = true
+	if mp.current == nil {
+		return nil
+	}
+	err := mp.current.Shutdown()
+	mp.current = nil
+	return err
+}
+
+// Resume starts a new plugin instance if the plugin is paused.
+func (mp *ManagedPlugin) Resume() error {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	mp.paused = false
+	if mp.current != nil || !mp.started {
+		return nil
+	}
+	plugin := mp.create()
+	if err := plugin.Start(mp.acc); err != nil {
+		return err
+	}
+	mp.current = plugin
+	return nil
+}
+
+// Paused tells whether the plugin is paused.
+func (mp *ManagedPlugin) Paused() bool {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	return mp.paused
+}
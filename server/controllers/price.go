@@ -0,0 +1,155 @@
+package controllers
+
+import (
+	"github.com/luca-moser/donapoc/server/price"
+	"github.com/luca-moser/donapoc/server/server/config"
+	"github.com/luca-moser/donapoc/server/utilities"
+	"github.com/pkg/errors"
+	"math"
+	"strings"
+	"time"
+)
+
+// price sources
+const (
+	PriceSourceStatic    = "static"
+	PriceSourceFile      = "file"
+	PriceSourceCoinGecko = "coingecko"
+)
+
+const (
+	defaultPriceCacheTTL = time.Duration(5) * time.Minute
+	defaultPriceMaxAge   = time.Duration(1) * time.Hour
+	defaultPriceTimeout  = time.Duration(10) * time.Second
+	iotasPerMi           = 1000000
+)
+
+// TotalSupply is the amount of iotas in existence.
+const TotalSupply = 2779530283277761
+
+var defaultCurrencies = []string{"USD", "EUR"}
+
+var ErrInvalidPriceSource = errors.New("invalid price source")
+var ErrPriceUnavailable = errors.New("fiat price is not available")
+var ErrAmountExceedsSupply = errors.New("amount exceeds the total supply")
+
+// FiatValues holds the value of an amount of iotas per currency.
+type FiatValues struct {
+	Values map[string]float64 `json:"values"`
+	// when the underlying rates were fetched
+	RatesAt time.Time `json:"rates_at"`
+}
+
+// PriceCtrl converts between iotas and fiat currencies using the configured price source.
+type PriceCtrl struct {
+	Config *config.Configuration `inject:""`
+	cache  *price.Cache
+}
+
+func (pc *PriceCtrl) Init() error {
+	logger, _ := utilities.GetLogger("price")
+	conf := pc.Config.App.Account.Price
+	if conf.Source == "" {
+		logger.Info("no price source configured, fiat values are disabled")
+		return nil
+	}
+
+	currencies := defaultCurrencies
+	if len(conf.Currencies) > 0 {
+		currencies = make([]string, len(conf.Currencies))
+		for i, currency := range conf.Currencies {
+			currencies[i] = strings.ToUpper(currency)
+		}
+	}
+
+	timeout := defaultPriceTimeout
+	if conf.Timeout != 0 {
+		timeout = time.Duration(conf.Timeout) * time.Second
+	}
+
+	var src price.Source
+	switch conf.Source {
+	case PriceSourceStatic:
+		rates := price.StaticSource{}
+		for currency, rate := range conf.Static {
+			rates[strings.ToUpper(currency)] = rate
+		}
+		src = rates
+	case PriceSourceFile:
+		if conf.File == "" {
+			return errors.Wrap(ErrInvalidPriceSource, "no price file configured")
+		}
+		src = price.NewFileSource(conf.File)
+	case PriceSourceCoinGecko:
+		src = price.NewCoinGeckoSource(timeout)
+	default:
+		return errors.Wrapf(ErrInvalidPriceSource, "'%s'", conf.Source)
+	}
+
+	ttl := defaultPriceCacheTTL
+	if conf.CacheTTL != 0 {
+		ttl = time.Duration(conf.CacheTTL) * time.Second
+	}
+	maxAge := defaultPriceMaxAge
+	if conf.MaxAge != 0 {
+		maxAge = time.Duration(conf.MaxAge) * time.Second
+	}
+	pc.cache = price.NewCache(src, currencies, ttl, maxAge)
+
+	// a failing source isn't fatal as it might recover later on
+	if _, _, err := pc.cache.Rates(); err != nil {
+		logger.Warn("unable to fetch initial fiat price", "source", conf.Source, "err", err)
+	}
+	logger.Info("fiat prices enabled", "source", conf.Source, "currencies", strings.Join(currencies, ","))
+	return nil
+}
+
+// Enabled tells whether a price source is configured.
+func (pc *PriceCtrl) Enabled() bool {
+	return pc.cache != nil
+}
+
+// FiatValues returns the value of the given amount of iotas in each configured currency.
+func (pc *PriceCtrl) FiatValues(iotas uint64) (*FiatValues, error) {
+	rates, at, err := pc.rates()
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]float64, len(rates))
+	for currency, rate := range rates {
+		values[currency] = float64(iotas) / iotasPerMi * rate
+	}
+	return &FiatValues{Values: values, RatesAt: at}, nil
+}
+
+// Iotas returns the amount of iotas which are worth the given amount of the given currency, rounded up.
+// Amounts worth more than the total supply are rejected.
+func (pc *PriceCtrl) Iotas(amount float64, currency string) (uint64, error) {
+	rates, _, err := pc.rates()
+	if err != nil {
+		return 0, err
+	}
+	rate, ok := rates[strings.ToUpper(currency)]
+	if !ok {
+		return 0, errors.Wrapf(price.ErrUnknownCurrency, "'%s'", currency)
+	}
+	if rate <= 0 {
+		return 0, errors.Wrapf(ErrPriceUnavailable, "no valid price for %s", currency)
+	}
+	iotas := math.Ceil(amount / rate * iotasPerMi)
+	if iotas > TotalSupply {
+		return 0, errors.Wrapf(ErrAmountExceedsSupply, "%v %s", amount, currency)
+	}
+	return uint64(iotas), nil
+}
+
+func (pc *PriceCtrl) rates() (price.Rates, time.Time, error) {
+	if pc.cache == nil {
+		return nil, time.Time{}, errors.Wrap(ErrPriceUnavailable, "no price source configured")
+	}
+	rates, at, err := pc.cache.Rates()
+	if err != nil {
+		return nil, time.Time{}, errors.Wrap(ErrPriceUnavailable, err.Error())
+	}
+	return rates, at, nil
+}
@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"github.com/luca-moser/donapoc/server/price"
+	"github.com/pkg/errors"
+	"testing"
+	"time"
+)
+
+func newStaticPriceCtrl(rates price.StaticSource) *PriceCtrl {
+	currencies := []string{}
+	for currency := range rates {
+		currencies = append(currencies, currency)
+	}
+	return &PriceCtrl{cache: price.NewCache(rates, currencies, time.Hour, 0)}
+}
+
+func TestPriceCtrlIotas(t *testing.T) {
+	pc := newStaticPriceCtrl(price.StaticSource{"USD": 0.25, "EUR": 0.3, "XXX": 0})
+	tests := []struct {
+		name     string
+		amount   float64
+		currency string
+		iotas    uint64
+		err      error
+	}{
+		{name: "whole Mi", amount: 1, currency: "USD", iotas: 4000000},
+		{name: "lower case currency", amount: 0.5, currency: "usd", iotas: 2000000},
+		{name: "rounded up", amount: 1, currency: "EUR", iotas: 3333334},
+		{name: "unknown currency", amount: 1, currency: "CHF", err: price.ErrUnknownCurrency},
+		{name: "invalid rate", amount: 1, currency: "XXX", err: ErrPriceUnavailable},
+		{name: "exceeds supply", amount: 1e12, currency: "USD", err: ErrAmountExceedsSupply},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			iotas, err := pc.Iotas(test.amount, test.currency)
+			if errors.Cause(err) != test.err {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+			if iotas != test.iotas {
+				t.Fatalf("expected %d iotas, got %d", test.iotas, iotas)
+			}
+		})
+	}
+}
+
+func TestPriceCtrlWithoutSource(t *testing.T) {
+	pc := &PriceCtrl{}
+	if _, err := pc.Iotas(1, "USD"); errors.Cause(err) != ErrPriceUnavailable {
+		t.Fatalf("expected %v, got %v", ErrPriceUnavailable, err)
+	}
+}
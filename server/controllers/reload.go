@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"github.com/iotaledger/iota.go/account"
+	"github.com/iotaledger/iota.go/api"
+	"github.com/luca-moser/donapoc/server/server/config"
+	"github.com/pkg/errors"
+	"reflect"
+)
+
+// Reload applies the settings of the given config which can change while the account is running:
+// the quorum, the intervals of the poller and the promoter/reattacher and the validity of new deposit addresses.
+// The plugins of the account are restarted if the quorum or one of the intervals changed.
+// If the new quorum can't be used, the previous one is kept while the other settings are still applied.
+func (ac *AccCtrl) Reload(conf *config.Configuration) error {
+	newConf := conf.App.Account
+	ac.reloadMu.Lock()
+	accConf := &ac.Config.App.Account
+	accConf.AddressValidityTimeoutDays = newConf.AddressValidityTimeoutDays
+	for i := range accConf.Campaigns {
+		for _, campaign := range newConf.Campaigns {
+			if campaign.ID == accConf.Campaigns[i].ID {
+				accConf.Campaigns[i].AddressValidityTimeoutDays = campaign.AddressValidityTimeoutDays
+			}
+		}
+	}
+
+	a := ac.iota
+	var quorumErr error
+	if !reflect.DeepEqual(accConf.Quorum, newConf.Quorum) {
+		newAPI, err := newQuorumAPI(newConf.Quorum)
+		if err != nil {
+			quorumErr = errors.Wrap(err, "unable to apply the new quorum, keeping the previous one")
+		} else {
+			a = newAPI
+			accConf.Quorum = newConf.Quorum
+		}
+	}
+	if a == ac.iota &&
+		accConf.TransferPollInterval == newConf.TransferPollInterval &&
+		accConf.PromoteReattachInterval == newConf.PromoteReattachInterval {
+		ac.reloadMu.Unlock()
+		return quorumErr
+	}
+
+	accConf.TransferPollInterval = newConf.TransferPollInterval
+	accConf.PromoteReattachInterval = newConf.PromoteReattachInterval
+
+	// the settings must not be mutated once the account runs, therefore the account gets a new copy
+	settings := &account.Settings{}
+	*settings = *ac.settings
+	settings.API = a
+	settings.PrepareTransfers = account.DefaultPrepareTransfers(a, settings.SeedProv)
+	for i, create := range ac.pluginFactories(settings, *accConf) {
+		ac.plugins[i].setCreate(create)
+	}
+	ac.iota = a
+	ac.settings = settings
+	ac.reloadMu.Unlock()
+
+	// a suspended account picks up the settings once the server is restarted
+	if !ac.Running() {
+		return quorumErr
+	}
+	if err := ac.Acc.UpdateSettings(settings); err != nil {
+		return errors.Wrap(err, "unable to update account settings")
+	}
+	ac.logger.Info("restarted plugins with reloaded settings", "nodes", accConf.Quorum.Nodes,
+		"poll_interval", newConf.TransferPollInterval, "promote_reattach_interval", newConf.PromoteReattachInterval)
+	return quorumErr
+}
+
+// QuorumConfig returns the quorum the account currently uses.
+func (ac *AccCtrl) QuorumConfig() config.QuorumConfig {
+	ac.reloadMu.RLock()
+	defer ac.reloadMu.RUnlock()
+	return ac.Config.App.Account.Quorum
+}
+
+// api returns the API the account currently uses.
+func (ac *AccCtrl) api() *api.API {
+	ac.reloadMu.RLock()
+	defer ac.reloadMu.RUnlock()
+	return ac.iota
+}
@@ -0,0 +1,185 @@
+package controllers
+
+import (
+	"github.com/iotaledger/iota.go/account/deposit"
+	"github.com/iotaledger/iota.go/account/event"
+	"github.com/luca-moser/donapoc/server/storage"
+	"time"
+)
+
+// emitted through the account's event machine with the *RotatedConditions as payload
+// whenever the shared deposit address of a campaign is replaced
+const EventConditionsRotated event.Event = 303
+
+const (
+	defaultRotationLeadTime      = time.Duration(24) * time.Hour
+	defaultRotationRetryInterval = time.Duration(30) * time.Second
+	rotationCheckInterval        = time.Duration(1) * time.Minute
+	// shared deposit addresses which expire within this duration are no longer handed out
+	minSharedAddressValidity = time.Duration(1) * time.Hour
+)
+
+// RotatedConditions is the new shared deposit address of a campaign.
+type RotatedConditions struct {
+	Campaign string       `json:"campaign"`
+	CDA      *deposit.CDA `json:"cda"`
+}
+
+// campaignIDs returns the ids of all campaigns including the default campaign.
+func (ac *AccCtrl) campaignIDs() []string {
+	campaignIDs := []string{""}
+	for _, campaign := range ac.Campaigns() {
+		campaignIDs = append(campaignIDs, campaign.ID)
+	}
+	return campaignIDs
+}
+
+// rotationLeadTime returns how long before its timeout the shared deposit address of the given campaign
+// is replaced. It is capped at half of the address validity so that an address is in use for some time.
+func (ac *AccCtrl) rotationLeadTime(campaignID string) time.Duration {
+	leadTime := defaultRotationLeadTime
+	if mins := ac.Config.App.Account.RotationLeadTimeMinutes; mins != 0 {
+		leadTime = time.Duration(mins) * time.Minute
+	}
+	if maxLeadTime := time.Duration(ac.addressValidityDays(campaignID)) * 24 * time.Hour / 2; leadTime > maxLeadTime {
+		return maxLeadTime
+	}
+	return leadTime
+}
+
+// rotateAt returns the time at which the given shared deposit address of the given campaign should be replaced.
+func (ac *AccCtrl) rotateAt(campaignID string, cda *deposit.CDA) time.Time {
+	return cda.TimeoutAt.Add(-ac.rotationLeadTime(campaignID))
+}
+
+// currentConditions returns the current shared deposit address of the given campaign.
+func (ac *AccCtrl) currentConditions(campaignID string) *deposit.CDA {
+	ac.checkCondMu.Lock()
+	defer ac.checkCondMu.Unlock()
+	return ac.current[campaignID]
+}
+
+// startRotation starts the scheduler which rotates the shared deposit addresses in the background.
+func (ac *AccCtrl) startRotation() {
+	if ac.DonationMode() != DonationModeShared {
+		return
+	}
+	retryInterval := defaultRotationRetryInterval
+	if secs := ac.Config.App.Account.RotationRetryInterval; secs != 0 {
+		retryInterval = time.Duration(secs) * time.Second
+	}
+	ac.rotationExit = make(chan struct{})
+	ac.rotationDone = make(chan struct{})
+	go ac.runRotation(retryInterval)
+	ac.logger.Info("deposit address rotation scheduled", "retry_interval", retryInterval)
+}
+
+func (ac *AccCtrl) runRotation(retryInterval time.Duration) {
+	defer close(ac.rotationDone)
+	ticker := time.NewTicker(rotationCheckInterval)
+	defer ticker.Stop()
+	retryAt := map[string]time.Time{}
+	for {
+		for _, campaignID := range ac.campaignIDs() {
+			if at, ok := retryAt[campaignID]; ok && time.Now().Before(at) {
+				continue
+			}
+			if err := ac.rotateIfDue(campaignID); err != nil {
+				retryAt[campaignID] = time.Now().Add(retryInterval)
+				ac.logger.Error("deposit address rotation failed", "campaign", campaignID, "retry_at", retryAt[campaignID], "err", err)
+				continue
+			}
+			delete(retryAt, campaignID)
+		}
+
+		// failed allocations are retried before the next regular check
+		next := ticker.C
+		var retry <-chan time.Time
+		if len(retryAt) > 0 {
+			retry = time.After(retryInterval)
+		}
+		select {
+		case <-next:
+		case <-retry:
+		case <-ac.rotationExit:
+			return
+		}
+	}
+}
+
+// rotateIfDue swaps in the next shared deposit address once the current one enters the lead time
+// and makes sure that the next one is allocated ahead of time.
+func (ac *AccCtrl) rotateIfDue(campaignID string) error {
+	ac.rotateMu.Lock()
+	defer ac.rotateMu.Unlock()
+	current := ac.currentConditions(campaignID)
+	if current == nil || !time.Now().Before(ac.rotateAt(campaignID, current)) {
+		if err := ac.rotate(campaignID); err != nil {
+			return err
+		}
+	}
+	return ac.preallocate(campaignID)
+}
+
+// preallocate allocates the next shared deposit address of the given campaign if there is none yet.
+// Its validity starts when it is going to be swapped in. rotateMu must be held.
+func (ac *AccCtrl) preallocate(campaignID string) error {
+	if ac.next[campaignID] != nil {
+		return nil
+	}
+	from := time.Now()
+	if current := ac.currentConditions(campaignID); current != nil && ac.rotateAt(campaignID, current).After(from) {
+		from = ac.rotateAt(campaignID, current)
+	}
+	timeoutAt := from.AddDate(0, 0, int(ac.addressValidityDays(campaignID)))
+	cda, err := ac.Acc.AllocateDepositAddress(&deposit.Conditions{TimeoutAt: &timeoutAt, MultiUse: true})
+	if err != nil {
+		return err
+	}
+	rec := storage.NewCDA(ac.Acc.ID(), cda)
+	rec.Campaign = campaignID
+	rec.Next = true
+	if err := ac.srvStore.AddCDA(rec); err != nil {
+		return err
+	}
+	ac.next[campaignID] = cda
+	ac.logger.Info("pre-allocated next deposit address", "campaign", campaignID, "address", cda.Address, "timeout_at", timeoutAt)
+	return nil
+}
+
+// rotate makes the pre-allocated next deposit address the current one of the given campaign.
+// A new address is allocated if there is no usable pre-allocated one. rotateMu must be held.
+func (ac *AccCtrl) rotate(campaignID string) error {
+	cda := ac.next[campaignID]
+	if cda == nil || cda.TimeoutAt.Before(time.Now().Add(minSharedAddressValidity)) {
+		timeoutAt := time.Now().AddDate(0, 0, int(ac.addressValidityDays(campaignID)))
+		var err error
+		cda, err = ac.Acc.AllocateDepositAddress(&deposit.Conditions{TimeoutAt: &timeoutAt, MultiUse: true})
+		if err != nil {
+			return err
+		}
+	}
+	rec := storage.NewCDA(ac.Acc.ID(), cda)
+	rec.Campaign = campaignID
+	if err := ac.srvStore.SetCurrentCDA(rec); err != nil {
+		return err
+	}
+	delete(ac.next, campaignID)
+	ac.checkCondMu.Lock()
+	ac.current[campaignID] = cda
+	ac.checkCondMu.Unlock()
+	ac.logger.Info("rotated deposit address", "campaign", campaignID, "address", cda.Address, "timeout_at", cda.TimeoutAt)
+	ac.EM.Emit(&RotatedConditions{Campaign: campaignID, CDA: cda}, EventConditionsRotated)
+	return nil
+}
+
+// stopRotation stops the rotation scheduler and waits for an ongoing rotation to finish.
+func (ac *AccCtrl) stopRotation() {
+	if ac.rotationExit == nil {
+		return
+	}
+	ac.rotationStop.Do(func() {
+		close(ac.rotationExit)
+	})
+	<-ac.rotationDone
+}
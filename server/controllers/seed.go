@@ -0,0 +1,50 @@
+package controllers
+
+import (
+	"github.com/luca-moser/donapoc/server/keystore"
+	"github.com/pkg/errors"
+	"sync"
+)
+
+var ErrNoSeed = errors.New("no seed configured")
+var ErrPlaintextSeed = errors.New("plaintext seed")
+
+// the passphrase is asked for only once, the keystores of the tenants share it with the main account
+var keystorePassphrase struct {
+	sync.Mutex
+	value string
+}
+
+// loadSeed returns the seed of the account from its keystore or, in dev mode, from the config.
+func (ac *AccCtrl) loadSeed() (string, error) {
+	conf := ac.Config.App.Account
+	if conf.Keystore.File == "" {
+		if conf.Seed == "" {
+			return "", errors.Wrap(ErrNoSeed, "configure a keystore file")
+		}
+		if !ac.Config.App.Dev {
+			return "", errors.Wrap(ErrPlaintextSeed, "plaintext seeds are only accepted in dev mode, convert it with the 'keystore' command")
+		}
+		ac.logger.Warn("using plaintext seed from config, use a keystore outside of dev mode")
+		return conf.Seed, nil
+	}
+
+	keystorePassphrase.Lock()
+	defer keystorePassphrase.Unlock()
+	var passphrase string
+	seed, err := keystore.Open(conf.Keystore.File, func() (string, error) {
+		if keystorePassphrase.value != "" {
+			passphrase = keystorePassphrase.value
+			return passphrase, nil
+		}
+		var err error
+		passphrase, err = keystore.Passphrase(conf.Keystore.PassphraseFile)
+		return passphrase, err
+	})
+	if err != nil {
+		return "", err
+	}
+	keystorePassphrase.value = passphrase
+	ac.logger.Info("loaded seed from keystore", "file", conf.Keystore.File)
+	return seed, nil
+}
@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"github.com/iotaledger/iota.go/account/builder"
+	"github.com/iotaledger/iota.go/account/store"
+	badger_store "github.com/iotaledger/iota.go/account/store/badger"
+	"github.com/iotaledger/iota.go/account/store/inmemory"
+	mongo_store "github.com/iotaledger/iota.go/account/store/mongo"
+	"github.com/luca-moser/donapoc/server/storage"
+	"github.com/luca-moser/donapoc/server/utilities"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// store backends
+const (
+	StoreBackendMongo  = "mongo"
+	StoreBackendBadger = "badger"
+	StoreBackendMemory = "memory"
+)
+
+var ErrInvalidStoreBackend = errors.New("invalid store backend")
+
+// initStores constructs the account store and the store for the server's own data
+// using the backend defined in the account config.
+func (ac *AccCtrl) initStores() error {
+	conf := ac.Config.App.Account
+	switch conf.Store.Backend {
+	case "", StoreBackendMongo:
+		mongoConf := conf.MongoDB
+		// the deposit addresses handed out by the server are kept next to the account state.
+		// the server store is opened first as the MongoDB account store can't be closed again
+		// in case the other store fails to initialise.
+		srvStore, err := storage.NewMongoStore(mongoConf.URI, &storage.MongoConfig{
+			DBName: mongoConf.DBName, CDACollName: mongoConf.CDACollName,
+			DonationCollName: mongoConf.DonationCollName, SweepCollName: mongoConf.SweepCollName,
+			WebhookCollName: mongoConf.WebhookCollName,
+		})
+		if err != nil {
+			return errors.Wrapf(err, "unable to initialise MongoDB server store at %s", mongoConf.URI)
+		}
+		accStore, err := mongo_store.NewMongoStore(mongoConf.URI, &mongo_store.Config{
+			DBName: mongoConf.DBName, CollName: mongoConf.CollName,
+		})
+		if err != nil {
+			srvStore.Close()
+			return errors.Wrapf(err, "unable to initialise MongoDB account store at %s", mongoConf.URI)
+		}
+		ac.store = accStore
+		ac.srvStore = srvStore
+
+	case StoreBackendBadger:
+		dir := conf.Store.Badger.Dir
+		if dir == "" {
+			return errors.Wrap(ErrInvalidStoreBackend, "badger store requires a data directory")
+		}
+		accDir, srvDir := filepath.Join(dir, "account"), filepath.Join(dir, "server")
+		for _, d := range []string{accDir, srvDir} {
+			if err := os.MkdirAll(d, 0700); err != nil {
+				return errors.Wrapf(err, "unable to create badger data directory %s", d)
+			}
+		}
+		accStore, err := badger_store.NewBadgerStore(accDir)
+		if err != nil {
+			return errors.Wrapf(err, "unable to initialise badger account store in %s", accDir)
+		}
+		kv, err := storage.NewBadgerKV(srvDir)
+		if err != nil {
+			accStore.Close()
+			return errors.Wrapf(err, "unable to initialise badger server store in %s", srvDir)
+		}
+		ac.store = accStore
+		ac.srvStore = storage.NewKVStore(kv)
+
+	case StoreBackendMemory:
+		ac.logger.Warn("using in-memory store, the account state is lost on shutdown")
+		ac.store = inmemory.NewInMemoryStore()
+		ac.srvStore = storage.NewKVStore(storage.NewMemoryKV())
+
+	default:
+		return errors.Wrapf(ErrInvalidStoreBackend, "'%s'", conf.Store.Backend)
+	}
+	ac.logger.Info("initialised store", "backend", ac.StoreBackend())
+	return nil
+}
+
+// StoreBackend returns the name of the configured store backend.
+func (ac *AccCtrl) StoreBackend() string {
+	if ac.Config.App.Account.Store.Backend == "" {
+		return StoreBackendMongo
+	}
+	return ac.Config.App.Account.Store.Backend
+}
+
+// Store returns the account store.
+func (ac *AccCtrl) Store() store.Store {
+	return ac.store
+}
+
+// OpenStores initialises the stores of the account without starting it and returns the id of the account,
+// e.g. to export or import the account state while the server isn't running.
+func (ac *AccCtrl) OpenStores() (string, error) {
+	logger, _ := utilities.GetLogger("acc")
+	ac.logger = logger
+	seed, err := ac.loadSeed()
+	if err != nil {
+		return "", err
+	}
+	if err := ac.initStores(); err != nil {
+		return "", err
+	}
+	// the id is derived from the seed, the account isn't started
+	acc, err := builder.NewBuilder().WithStore(ac.store).WithSeed(seed).Build()
+	if err != nil {
+		ac.closeStores()
+		return "", errors.Wrap(err, "unable to instantiate account")
+	}
+	return acc.ID(), nil
+}
+
+// CloseStores closes the stores opened by OpenStores.
+func (ac *AccCtrl) CloseStores() error {
+	return ac.closeStores()
+}
+
+// closeStores closes the server store and the account store if the latter supports it.
+func (ac *AccCtrl) closeStores() error {
+	if ac.srvStore != nil {
+		if err := ac.srvStore.Close(); err != nil {
+			return errors.Wrap(err, "unable to close server store")
+		}
+	}
+	if closer, ok := ac.store.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			return errors.Wrap(err, "unable to close account store")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"github.com/iotaledger/iota.go/account"
+	"github.com/iotaledger/iota.go/account/event"
+	"github.com/luca-moser/donapoc/server/storage"
+	"github.com/luca-moser/donapoc/server/utilities"
+	"github.com/pkg/errors"
+	"gopkg.in/inconshreveable/log15.v2"
+	"sync"
+	"time"
+)
+
+// emitted through the account's event machine with the *storage.Sweep as payload
+const EventSweep event.Event = 300
+
+// sweep reasons
+const (
+	SweepReasonThreshold = "threshold"
+	SweepReasonSchedule  = "schedule"
+	SweepReasonManual    = "manual"
+)
+
+const defaultSweepCheckInterval = time.Duration(60) * time.Second
+
+var ErrInvalidSweepConfig = errors.New("invalid sweep config")
+var ErrSweepCooldown = errors.New("sweep cool-down is active")
+var ErrSweepBelowMinimum = errors.New("usable balance is below the minimum sweep amount")
+var ErrSweepDisabled = errors.New("sweeping is not enabled")
+var ErrSweepSuspended = errors.New("account is suspended, sweeps resume after a restart")
+
+// SweepCtrl sends the usable balance of the account to the configured cold wallet address
+// when the balance passes the threshold or on a schedule.
+type SweepCtrl struct {
+	AccCtrl   *AccCtrl `inject:""`
+	logger    log15.Logger
+	mu        sync.Mutex
+	lastSweep time.Time
+	lastSched time.Time
+	exit      chan struct{}
+	done      chan struct{}
+}
+
+func (sc *SweepCtrl) Init() error {
+	logger, _ := utilities.GetLogger("sweep")
+	sc.logger = logger
+
+	conf := sc.AccCtrl.Config.App.Account.Sweep
+	if !conf.Enabled {
+		return nil
+	}
+	if err := checkAddress(conf.Address); err != nil {
+		return errors.Wrapf(ErrInvalidSweepConfig, "cold wallet address: %s", err)
+	}
+
+	// continue the cool-down of the last sweep before the restart
+	sweeps, err := sc.AccCtrl.srvStore.Sweeps(sc.AccCtrl.Acc.ID(), 1)
+	if err != nil {
+		return errors.Wrap(err, "unable to load last sweep")
+	}
+	if len(sweeps) > 0 {
+		sc.lastSweep = sweeps[0].At
+	}
+	sc.lastSched = time.Now()
+
+	checkInterval := defaultSweepCheckInterval
+	if conf.CheckInterval != 0 {
+		checkInterval = time.Duration(conf.CheckInterval) * time.Second
+	}
+	sc.exit = make(chan struct{})
+	sc.done = make(chan struct{})
+	go sc.run(checkInterval)
+	logger.Info("sweeper enabled", "address", conf.Address, "threshold", conf.Threshold, "interval", conf.Interval)
+	return nil
+}
+
+func (sc *SweepCtrl) run(checkInterval time.Duration) {
+	defer close(sc.done)
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-sc.exit:
+			return
+		}
+		// an account suspended by a state import must not send anything until the server is restarted
+		if !sc.AccCtrl.Running() {
+			continue
+		}
+		reason, err := sc.due()
+		if err != nil {
+			sc.logger.Error("unable to check whether a sweep is due", "err", err)
+			continue
+		}
+		if reason == "" {
+			continue
+		}
+		if _, err := sc.Sweep(reason); err != nil {
+			switch errors.Cause(err) {
+			case ErrSweepCooldown, ErrSweepBelowMinimum, ErrSweepSuspended:
+				sc.logger.Debug("skipped sweep", "reason", reason, "err", err)
+			default:
+				sc.logger.Error("sweep failed", "reason", reason, "err", err)
+			}
+		}
+	}
+}
+
+// due returns the reason why a sweep is due or an empty string if none is.
+func (sc *SweepCtrl) due() (string, error) {
+	conf := sc.AccCtrl.Config.App.Account.Sweep
+	if conf.Interval != 0 && time.Since(sc.lastSched) >= time.Duration(conf.Interval)*time.Second {
+		sc.lastSched = time.Now()
+		return SweepReasonSchedule, nil
+	}
+	if conf.Threshold == 0 {
+		return "", nil
+	}
+	usable, err := sc.AccCtrl.Acc.AvailableBalance()
+	if err != nil {
+		return "", err
+	}
+	if usable >= conf.Threshold {
+		return SweepReasonThreshold, nil
+	}
+	return "", nil
+}
+
+// Sweep sends the usable balance to the cold wallet, respecting the cool-down and minimum amount.
+// Every executed sweep, including failed ones, is recorded and emitted as EventSweep.
+// Only a successful sweep starts the cool-down, so that a failed one is retried with the next check.
+func (sc *SweepCtrl) Sweep(reason string) (*storage.Sweep, error) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	conf := sc.AccCtrl.Config.App.Account.Sweep
+	acc := sc.AccCtrl.Acc
+
+	if !conf.Enabled {
+		return nil, ErrSweepDisabled
+	}
+	if !sc.AccCtrl.Running() {
+		return nil, ErrSweepSuspended
+	}
+
+	if cooldown := time.Duration(conf.Cooldown) * time.Second; time.Since(sc.lastSweep) < cooldown {
+		return nil, errors.Wrapf(ErrSweepCooldown, "next sweep possible at %s", sc.lastSweep.Add(cooldown).Format(time.RFC3339))
+	}
+	usable, err := acc.AvailableBalance()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to query usable balance")
+	}
+	if usable == 0 || usable < conf.MinAmount {
+		return nil, errors.Wrapf(ErrSweepBelowMinimum, "%d < %d", usable, conf.MinAmount)
+	}
+
+	now := time.Now()
+	sweep := &storage.Sweep{
+		ID: fmt.Sprintf("failed-%d", now.UnixNano()), AccountID: acc.ID(),
+		Address: conf.Address, Value: usable, Reason: reason, At: now,
+	}
+	sc.logger.Info("sweeping funds to cold wallet", "value", usable, "reason", reason)
+	bndl, sendErr := acc.Send(account.Recipient{Address: conf.Address, Value: usable})
+	if sendErr != nil {
+		sweep.Error = sendErr.Error()
+	} else {
+		sweep.ID, sweep.Tail = bndl[0].Bundle, bndl[0].Hash
+		sc.lastSweep = now
+	}
+
+	if err := sc.AccCtrl.srvStore.AddSweep(sweep); err != nil {
+		sc.logger.Error("unable to record sweep", "sweep", sweep.ID, "err", err)
+	}
+	sc.AccCtrl.EM.Emit(sweep, EventSweep)
+	if sendErr != nil {
+		return sweep, errors.Wrap(sendErr, "unable to send sweep transfer")
+	}
+	return sweep, nil
+}
+
+// Sweeps returns the most recent sweeps of the account.
+func (sc *SweepCtrl) Sweeps(limit int64) ([]*storage.Sweep, error) {
+	return sc.AccCtrl.srvStore.Sweeps(sc.AccCtrl.Acc.ID(), limit)
+}
+
+// Shutdown stops the sweep scheduler. It must be shut down before the account.
+func (sc *SweepCtrl) Shutdown(ctx context.Context) error {
+	if sc.exit == nil {
+		return nil
+	}
+	close(sc.exit)
+	select {
+	case <-sc.done:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "sweeper did not stop in time")
+	}
+}
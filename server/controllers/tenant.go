@@ -0,0 +1,165 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"github.com/luca-moser/donapoc/server/server/config"
+	"github.com/luca-moser/donapoc/server/storage"
+	"github.com/luca-moser/donapoc/server/utilities"
+	"github.com/pkg/errors"
+	"gopkg.in/inconshreveable/log15.v2"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var ErrInvalidTenant = errors.New("invalid tenant")
+
+// Tenant is an additional account hosted by the server.
+type Tenant struct {
+	ID         string
+	AccCtrl    *AccCtrl
+	LedgerCtrl *LedgerCtrl
+	// set if the tenant couldn't be started
+	Err error
+}
+
+// Running tells whether the tenant's account is up.
+func (t *Tenant) Running() bool {
+	return t.Err == nil
+}
+
+// TenantCtrl starts the accounts of the tenants defined in the config.
+// A tenant failing to start is only logged and doesn't affect the other tenants.
+type TenantCtrl struct {
+	Config  *config.Configuration `inject:""`
+	tenants []*Tenant
+	logger  log15.Logger
+}
+
+func (tc *TenantCtrl) Init() error {
+	logger, _ := utilities.GetLogger("tenants")
+	tc.logger = logger
+
+	seen := map[string]struct{}{}
+	for _, tenantConf := range tc.Config.App.Account.Tenants {
+		tenant := &Tenant{ID: tenantConf.ID}
+		tc.tenants = append(tc.tenants, tenant)
+
+		if _, ok := seen[tenantConf.ID]; ok || tenantConf.ID == "" {
+			tenant.Err = errors.Wrapf(ErrInvalidTenant, "missing or duplicate tenant id '%s'", tenantConf.ID)
+			logger.Error("unable to start tenant", "tenant", tenant.ID, "err", tenant.Err)
+			continue
+		}
+		if !config.IsValidTenantID(tenantConf.ID) {
+			tenant.Err = errors.Wrapf(ErrInvalidTenant, "tenant id '%s' contains characters not allowed in paths", tenantConf.ID)
+			logger.Error("unable to start tenant", "tenant", tenant.ID, "err", tenant.Err)
+			continue
+		}
+		seen[tenantConf.ID] = struct{}{}
+
+		if err := tc.start(tenant, tenantConf); err != nil {
+			tenant.Err = err
+			logger.Error("unable to start tenant", "tenant", tenant.ID, "err", err)
+			continue
+		}
+		logger.Info("started tenant", "tenant", tenant.ID, "account", tenant.AccCtrl.Acc.ID())
+	}
+	return nil
+}
+
+// start builds and starts the account and ledger of the given tenant.
+func (tc *TenantCtrl) start(tenant *Tenant, tenantConf config.TenantConfig) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("tenant panicked on startup: %v", r)
+		}
+		if err != nil && tenant.AccCtrl != nil {
+			tenant.AccCtrl.Shutdown(context.Background())
+		}
+	}()
+
+	tenant.AccCtrl = &AccCtrl{TenantID: tenant.ID, Config: tc.tenantConfig(tenantConf)}
+	if err := tenant.AccCtrl.Init(); err != nil {
+		return err
+	}
+	tenant.LedgerCtrl = &LedgerCtrl{AccCtrl: tenant.AccCtrl}
+	return tenant.LedgerCtrl.Init()
+}
+
+// tenantConfig derives the configuration of the given tenant from the main configuration.
+func (tc *TenantCtrl) tenantConfig(tenantConf config.TenantConfig) *config.Configuration {
+	conf := *tc.Config
+	accConf := conf.App.Account
+	accConf.Seed = tenantConf.Seed
+	accConf.Keystore.File = tenantConf.Keystore
+	accConf.Campaigns = nil
+	accConf.Tenants = nil
+	accConf.Goal = config.GoalConfig{}
+	accConf.Webhooks.Endpoints = nil
+	accConf.MongoDB.CollName = tenantConf.CollName
+	if accConf.MongoDB.CollName == "" {
+		accConf.MongoDB.CollName = fmt.Sprintf("%s_%s", tc.Config.App.Account.MongoDB.CollName, tenantConf.ID)
+	}
+	// the records of the server store are looked up by their own ids (addresses, bundle hashes),
+	// therefore every tenant gets its own collections instead of sharing the ones of the main account
+	accConf.MongoDB.CDACollName = tenantCollName(accConf.MongoDB.CDACollName, storage.DefaultCDACollName, tenantConf.ID)
+	accConf.MongoDB.DonationCollName = tenantCollName(accConf.MongoDB.DonationCollName, storage.DefaultDonationCollName, tenantConf.ID)
+	accConf.MongoDB.SweepCollName = tenantCollName(accConf.MongoDB.SweepCollName, storage.DefaultSweepCollName, tenantConf.ID)
+	accConf.MongoDB.WebhookCollName = tenantCollName(accConf.MongoDB.WebhookCollName, storage.DefaultWebhookCollName, tenantConf.ID)
+	accConf.Store.Badger.Dir = filepath.Join(accConf.Store.Badger.Dir, "tenants", tenantConf.ID)
+	conf.App.Account = accConf
+	return &conf
+}
+
+// tenantCollName returns the tenant's collection corresponding to the given collection of the main account.
+func tenantCollName(collName string, defaultCollName string, tenantID string) string {
+	if collName == "" {
+		collName = defaultCollName
+	}
+	return fmt.Sprintf("%s_%s", collName, tenantID)
+}
+
+// Tenants returns all configured tenants, including the ones which failed to start.
+func (tc *TenantCtrl) Tenants() []*Tenant {
+	return tc.tenants
+}
+
+// Reload applies the runtime reloadable settings of the given config to the accounts of all running tenants.
+func (tc *TenantCtrl) Reload(conf *config.Configuration) error {
+	var failed []string
+	for _, tenant := range tc.tenants {
+		if !tenant.Running() {
+			continue
+		}
+		if err := tenant.AccCtrl.Reload(conf); err != nil {
+			tc.logger.Error("unable to reload tenant", "tenant", tenant.ID, "err", err)
+			failed = append(failed, fmt.Sprintf("%s: %s", tenant.ID, err))
+		}
+	}
+	if len(failed) > 0 {
+		return errors.Errorf("unable to reload %d tenant(s): %s", len(failed), strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// Shutdown shuts down the accounts of all running tenants.
+func (tc *TenantCtrl) Shutdown(ctx context.Context) error {
+	var wg sync.WaitGroup
+	errs := make(chan error, len(tc.tenants))
+	for _, tenant := range tc.tenants {
+		if !tenant.Running() {
+			continue
+		}
+		wg.Add(1)
+		go func(tenant *Tenant) {
+			defer wg.Done()
+			if err := tenant.AccCtrl.Shutdown(ctx); err != nil {
+				errs <- errors.Wrapf(err, "unable to shutdown tenant %s", tenant.ID)
+			}
+		}(tenant)
+	}
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
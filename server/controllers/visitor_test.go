@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"fmt"
+	"github.com/iotaledger/iota.go/account"
+	"github.com/iotaledger/iota.go/account/deposit"
+	"github.com/luca-moser/donapoc/server/server/config"
+	"github.com/luca-moser/donapoc/server/storage"
+	"github.com/pkg/errors"
+	"gopkg.in/inconshreveable/log15.v2"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeAccount hands out numbered deposit addresses and counts the allocations.
+type fakeAccount struct {
+	account.Account
+	mu    sync.Mutex
+	calls int
+}
+
+func (acc *fakeAccount) ID() string {
+	return "test"
+}
+
+func (acc *fakeAccount) AllocateDepositAddress(conds *deposit.Conditions) (*deposit.CDA, error) {
+	acc.mu.Lock()
+	defer acc.mu.Unlock()
+	acc.calls++
+	// slow enough for concurrent requests to overlap
+	time.Sleep(time.Millisecond * 10)
+	address := fmt.Sprintf("%09d", acc.calls) + strings.Repeat("9", 81)
+	return &deposit.CDA{Address: address, Conditions: *conds}, nil
+}
+
+func newVisitorAccCtrl(maxPerClient uint64) (*AccCtrl, *fakeAccount) {
+	acc := &fakeAccount{}
+	conf := &config.Configuration{}
+	conf.App.Account.MaxVisitorAddressesPerClient = maxPerClient
+	ac := &AccCtrl{
+		Acc: acc, Config: conf, srvStore: storage.NewKVStore(storage.NewMemoryKV()),
+		visitors: map[string]*visitorCDA{}, logger: log15.New(),
+	}
+	ac.logger.SetHandler(log15.DiscardHandler())
+	return ac, acc
+}
+
+func TestGenerateVisitorDonationAddress(t *testing.T) {
+	ac, acc := newVisitorAccCtrl(3)
+	amount, other := uint64(100), uint64(200)
+
+	first, err := ac.GenerateVisitorDonationAddress("", "a", "1.1.1.1", &amount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := ac.GenerateVisitorDonationAddress("", "a", "1.1.1.1", &amount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Address != first.Address {
+		t.Fatalf("expected the same address for the same session and amount, got %s and %s", first.Address, again.Address)
+	}
+
+	changed, err := ac.GenerateVisitorDonationAddress("", "a", "1.1.1.1", &other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed.Address == first.Address || *changed.ExpectedAmount != other {
+		t.Fatalf("expected a new address with the new amount, got %s with %d", changed.Address, *changed.ExpectedAmount)
+	}
+	rec, err := ac.srvStore.CDA(changed.Address[:81])
+	if err != nil || rec == nil || *rec.ExpectedAmount != other {
+		t.Fatalf("expected the new address to be stored with the new amount, got %v (%v)", rec, err)
+	}
+
+	// the replaced address is still monitored, so it counts towards the maximum of the client
+	if _, err := ac.GenerateVisitorDonationAddress("", "b", "1.1.1.1", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ac.GenerateVisitorDonationAddress("", "c", "1.1.1.1", nil); errors.Cause(err) != ErrTooManyVisitorAddresses {
+		t.Fatalf("expected %v, got %v", ErrTooManyVisitorAddresses, err)
+	}
+	if strings.Contains(fmt.Sprint(err), "1.1.1.1") {
+		t.Fatalf("expected the error to not contain the client, got %v", err)
+	}
+	if _, err := ac.GenerateVisitorDonationAddress("", "c", "2.2.2.2", nil); err != nil {
+		t.Fatal(err)
+	}
+	if acc.calls != 4 {
+		t.Fatalf("expected 4 allocations, got %d", acc.calls)
+	}
+}
+
+func TestGenerateVisitorDonationAddressConcurrently(t *testing.T) {
+	ac, acc := newVisitorAccCtrl(1)
+	var wg sync.WaitGroup
+	addresses := make([]string, 5)
+	for i := range addresses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cda, err := ac.GenerateVisitorDonationAddress("", "a", "1.1.1.1", nil)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			addresses[i] = cda.Address
+		}(i)
+	}
+	wg.Wait()
+	if acc.calls != 1 {
+		t.Fatalf("expected the requests of a session to share one allocation, got %d", acc.calls)
+	}
+	for _, address := range addresses {
+		if address != addresses[0] {
+			t.Fatalf("expected the same address for all requests, got %v", addresses)
+		}
+	}
+}
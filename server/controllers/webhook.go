@@ -0,0 +1,391 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/iotaledger/iota.go/account/event/listener"
+	"github.com/iotaledger/iota.go/bundle"
+	"github.com/luca-moser/donapoc/server/server/config"
+	"github.com/luca-moser/donapoc/server/storage"
+	"github.com/luca-moser/donapoc/server/utilities"
+	"github.com/pkg/errors"
+	"gopkg.in/inconshreveable/log15.v2"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// webhook event types
+const (
+	WebhookEventReceivingDeposit = "receiving_deposit"
+	WebhookEventReceivedDeposit  = "received_deposit"
+	WebhookEventSent             = "sent"
+	WebhookEventConfirmed        = "confirmed"
+	WebhookEventError            = "error"
+)
+
+// webhook request headers
+const (
+	WebhookSignatureHeader = "X-Donapoc-Signature"
+	WebhookEventHeader     = "X-Donapoc-Event"
+	WebhookDeliveryHeader  = "X-Donapoc-Delivery"
+)
+
+const (
+	defaultWebhookMaxAttempts   = 10
+	defaultWebhookRetryDelay    = time.Duration(10) * time.Second
+	defaultWebhookMaxRetryDelay = time.Duration(1) * time.Hour
+	defaultWebhookTimeout       = time.Duration(10) * time.Second
+	webhookCheckInterval        = time.Duration(5) * time.Second
+	webhookBatchSize            = 50
+)
+
+var webhookEvents = map[string]struct{}{
+	WebhookEventReceivingDeposit: {}, WebhookEventReceivedDeposit: {},
+	WebhookEventSent: {}, WebhookEventConfirmed: {}, WebhookEventError: {},
+}
+
+var ErrInvalidWebhookConfig = errors.New("invalid webhook config")
+
+// WebhookPayload is the body posted to webhook endpoints. Its fields are part of the public
+// webhook API and must not change in incompatible ways.
+type WebhookPayload struct {
+	// the delivery id, stays the same across retries
+	ID      string    `json:"id"`
+	Event   string    `json:"event"`
+	Account string    `json:"account"`
+	At      time.Time `json:"at"`
+	// a *WebhookBundle for transfer and deposit events, a *WebhookError for errors
+	Data interface{} `json:"data"`
+}
+
+// WebhookBundle describes the bundle of a transfer or deposit event.
+type WebhookBundle struct {
+	BundleHash   string               `json:"bundle_hash"`
+	Tail         string               `json:"tail"`
+	Transactions []WebhookTransaction `json:"transactions"`
+}
+
+// WebhookTransaction is a transaction of a WebhookBundle.
+type WebhookTransaction struct {
+	Hash         string `json:"hash"`
+	Address      string `json:"address"`
+	Value        int64  `json:"value"`
+	Tag          string `json:"tag"`
+	CurrentIndex uint64 `json:"current_index"`
+}
+
+// WebhookError describes an internal error of the account.
+type WebhookError struct {
+	Error string `json:"error"`
+}
+
+func newWebhookBundle(bndl bundle.Bundle) *WebhookBundle {
+	wb := &WebhookBundle{Transactions: make([]WebhookTransaction, len(bndl))}
+	if len(bndl) > 0 {
+		wb.BundleHash, wb.Tail = bndl[0].Bundle, bndl[0].Hash
+	}
+	for i := range bndl {
+		tx := &bndl[i]
+		wb.Transactions[i] = WebhookTransaction{
+			Hash: tx.Hash, Address: tx.Address, Value: tx.Value, Tag: tx.Tag, CurrentIndex: tx.CurrentIndex,
+		}
+	}
+	return wb
+}
+
+// SignWebhookPayload returns the hex encoded HMAC-SHA256 of the given body, as sent in the signature header.
+func SignWebhookPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookCtrl posts account events to the configured webhook endpoints.
+// Deliveries are persisted and retried with exponential backoff until they succeed or run out of attempts.
+type WebhookCtrl struct {
+	AccCtrl   *AccCtrl `inject:""`
+	logger    log15.Logger
+	endpoints map[string]*config.WebhookConfig
+	client    *http.Client
+	notify    chan struct{}
+	exit      chan struct{}
+	done      chan struct{}
+}
+
+func (wc *WebhookCtrl) Init() error {
+	logger, _ := utilities.GetLogger("webhook")
+	wc.logger = logger
+
+	conf := wc.AccCtrl.Config.App.Account.Webhooks
+	if len(conf.Endpoints) == 0 {
+		return nil
+	}
+	wc.endpoints = map[string]*config.WebhookConfig{}
+	for i := range conf.Endpoints {
+		endpoint := &conf.Endpoints[i]
+		if err := checkWebhookEndpoint(endpoint); err != nil {
+			return err
+		}
+		if _, ok := wc.endpoints[endpoint.ID]; ok {
+			return errors.Wrapf(ErrInvalidWebhookConfig, "duplicate endpoint id '%s'", endpoint.ID)
+		}
+		wc.endpoints[endpoint.ID] = endpoint
+	}
+
+	timeout := defaultWebhookTimeout
+	if conf.Timeout != 0 {
+		timeout = time.Duration(conf.Timeout) * time.Second
+	}
+	wc.client = &http.Client{Timeout: timeout}
+
+	lis := listener.NewChannelEventListener(wc.AccCtrl.EM).
+		RegReceivingDeposits().
+		RegReceivedDeposits().
+		RegSentTransfers().
+		RegConfirmedTransfers().
+		RegInternalErrors().
+		RegAccountShutdown()
+
+	wc.notify = make(chan struct{}, 1)
+	wc.exit = make(chan struct{})
+	wc.done = make(chan struct{})
+
+	go func() {
+		defer lis.Close()
+		for {
+			var ev string
+			var data interface{}
+			select {
+			case bndl := <-lis.ReceivingDeposit:
+				ev, data = WebhookEventReceivingDeposit, newWebhookBundle(bndl)
+			case bndl := <-lis.ReceivedDeposit:
+				ev, data = WebhookEventReceivedDeposit, newWebhookBundle(bndl)
+			case bndl := <-lis.SentTransfer:
+				ev, data = WebhookEventSent, newWebhookBundle(bndl)
+			case bndl := <-lis.TransferConfirmed:
+				ev, data = WebhookEventConfirmed, newWebhookBundle(bndl)
+			case err := <-lis.InternalError:
+				ev, data = WebhookEventError, &WebhookError{Error: err.Error()}
+			case <-lis.Shutdown:
+				return
+			}
+			if err := wc.enqueue(ev, data); err != nil {
+				logger.Error("unable to queue webhook deliveries", "event", ev, "err", err)
+			}
+		}
+	}()
+
+	go wc.run()
+	logger.Info("webhooks enabled", "endpoints", len(wc.endpoints))
+	return nil
+}
+
+func checkWebhookEndpoint(endpoint *config.WebhookConfig) error {
+	if endpoint.ID == "" {
+		return errors.Wrap(ErrInvalidWebhookConfig, "endpoint without id")
+	}
+	if u, err := url.Parse(endpoint.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.Wrapf(ErrInvalidWebhookConfig, "endpoint '%s' has an invalid url", endpoint.ID)
+	}
+	if endpoint.Secret == "" {
+		return errors.Wrapf(ErrInvalidWebhookConfig, "endpoint '%s' has no secret", endpoint.ID)
+	}
+	if len(endpoint.Events) == 0 {
+		return errors.Wrapf(ErrInvalidWebhookConfig, "endpoint '%s' subscribes to no events", endpoint.ID)
+	}
+	for _, ev := range endpoint.Events {
+		if _, ok := webhookEvents[ev]; !ok {
+			return errors.Wrapf(ErrInvalidWebhookConfig, "endpoint '%s' subscribes to unknown event '%s'", endpoint.ID, ev)
+		}
+	}
+	return nil
+}
+
+func subscribed(endpoint *config.WebhookConfig, ev string) bool {
+	for _, e := range endpoint.Events {
+		if e == ev {
+			return true
+		}
+	}
+	return false
+}
+
+// enqueue persists a delivery of the given event for every endpoint subscribed to it.
+func (wc *WebhookCtrl) enqueue(ev string, data interface{}) error {
+	now := time.Now()
+	accountID := wc.AccCtrl.Acc.ID()
+	var queued bool
+	for _, endpoint := range wc.endpoints {
+		if !subscribed(endpoint, ev) {
+			continue
+		}
+		id, err := newDeliveryID()
+		if err != nil {
+			return err
+		}
+		payload, err := json.Marshal(&WebhookPayload{ID: id, Event: ev, Account: accountID, At: now, Data: data})
+		if err != nil {
+			return err
+		}
+		d := &storage.WebhookDelivery{
+			ID: id, AccountID: accountID, Endpoint: endpoint.ID, Event: ev, Payload: string(payload),
+			Status: storage.DeliveryPending, NextAttemptAt: now, CreatedAt: now,
+		}
+		if err := wc.AccCtrl.srvStore.SaveDelivery(d); err != nil {
+			return errors.Wrapf(err, "unable to save delivery for endpoint %s", endpoint.ID)
+		}
+		queued = true
+	}
+	if queued {
+		select {
+		case wc.notify <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+func newDeliveryID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (wc *WebhookCtrl) run() {
+	defer close(wc.done)
+	ticker := time.NewTicker(webhookCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-wc.notify:
+		case <-wc.exit:
+			return
+		}
+		deliveries, err := wc.AccCtrl.srvStore.DueDeliveries(wc.AccCtrl.Acc.ID(), time.Now(), webhookBatchSize)
+		if err != nil {
+			wc.logger.Error("unable to load due webhook deliveries", "err", err)
+			continue
+		}
+		for _, d := range deliveries {
+			select {
+			case <-wc.exit:
+				return
+			default:
+			}
+			wc.attempt(d)
+		}
+	}
+}
+
+// attempt posts the given delivery to its endpoint and persists the outcome.
+func (wc *WebhookCtrl) attempt(d *storage.WebhookDelivery) {
+	now := time.Now()
+	d.Attempts++
+	d.LastAttemptAt = &now
+
+	endpoint, ok := wc.endpoints[d.Endpoint]
+	var err error
+	if !ok {
+		err = fmt.Errorf("endpoint '%s' is no longer configured", d.Endpoint)
+		d.Attempts = wc.maxAttempts()
+	} else {
+		d.LastStatusCode, err = wc.post(endpoint, d)
+	}
+
+	switch {
+	case err == nil:
+		d.Status, d.LastError, d.DeliveredAt = storage.DeliveryDelivered, "", &now
+		wc.logger.Debug("delivered webhook", "endpoint", d.Endpoint, "event", d.Event, "delivery", d.ID)
+	case d.Attempts >= wc.maxAttempts():
+		d.Status, d.LastError = storage.DeliveryFailed, err.Error()
+		wc.logger.Error("giving up webhook delivery", "endpoint", d.Endpoint, "delivery", d.ID, "attempts", d.Attempts, "err", err)
+	default:
+		d.LastError = err.Error()
+		d.NextAttemptAt = now.Add(wc.retryDelay(d.Attempts))
+		wc.logger.Warn("webhook delivery failed", "endpoint", d.Endpoint, "delivery", d.ID, "next_attempt_at", d.NextAttemptAt, "err", err)
+	}
+
+	if err := wc.AccCtrl.srvStore.SaveDelivery(d); err != nil {
+		wc.logger.Error("unable to save webhook delivery", "delivery", d.ID, "err", err)
+	}
+}
+
+// post sends the delivery's payload to the endpoint. Any 2xx response counts as delivered.
+func (wc *WebhookCtrl) post(endpoint *config.WebhookConfig, d *storage.WebhookDelivery) (int, error) {
+	body := []byte(d.Payload)
+	req, err := http.NewRequest(http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(endpoint.Secret, body))
+	req.Header.Set(WebhookEventHeader, d.Event)
+	req.Header.Set(WebhookDeliveryHeader, d.ID)
+	res, err := wc.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, res.Body)
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("endpoint responded with status %d", res.StatusCode)
+	}
+	return res.StatusCode, nil
+}
+
+func (wc *WebhookCtrl) maxAttempts() int {
+	if n := wc.AccCtrl.Config.App.Account.Webhooks.MaxAttempts; n > 0 {
+		return n
+	}
+	return defaultWebhookMaxAttempts
+}
+
+// retryDelay returns the delay before the next attempt, doubling with every failed attempt.
+func (wc *WebhookCtrl) retryDelay(attempts int) time.Duration {
+	conf := wc.AccCtrl.Config.App.Account.Webhooks
+	delay, maxDelay := defaultWebhookRetryDelay, defaultWebhookMaxRetryDelay
+	if conf.RetryDelay != 0 {
+		delay = time.Duration(conf.RetryDelay) * time.Second
+	}
+	if conf.MaxRetryDelay != 0 {
+		maxDelay = time.Duration(conf.MaxRetryDelay) * time.Second
+	}
+	for i := 1; i < attempts && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		return maxDelay
+	}
+	return delay
+}
+
+// Deliveries returns the webhook deliveries of the account matching the given query.
+func (wc *WebhookCtrl) Deliveries(q *storage.DeliveryQuery) ([]*storage.WebhookDelivery, error) {
+	return wc.AccCtrl.srvStore.Deliveries(wc.AccCtrl.Acc.ID(), q)
+}
+
+// Shutdown stops delivering webhooks. Pending deliveries are retried after the next start.
+func (wc *WebhookCtrl) Shutdown(ctx context.Context) error {
+	if wc.exit == nil {
+		return nil
+	}
+	close(wc.exit)
+	select {
+	case <-wc.done:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "webhook deliverer did not stop in time")
+	}
+}
@@ -0,0 +1,229 @@
+// Package keystore stores a seed in a file encrypted with a passphrase (scrypt and AES-256-GCM).
+package keystore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/iotaledger/iota.go/consts"
+	"github.com/iotaledger/iota.go/guards"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/crypto/ssh/terminal"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// Version is the version of the file format written by this package.
+const Version = 1
+
+// PassphraseEnv is the environment variable holding the passphrase.
+const PassphraseEnv = "DONAPOC_KEYSTORE_PASSPHRASE"
+
+const (
+	kdfScrypt    = "scrypt"
+	cipherAESGCM = "aes-256-gcm"
+
+	// the recommended scrypt parameters for interactive logins as of 2017
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+	saltSize     = 32
+)
+
+var ErrInvalidSeed = errors.New("invalid seed")
+var ErrWrongPassphrase = errors.New("wrong passphrase or corrupted keystore")
+var ErrNoPassphrase = errors.New("no keystore passphrase given")
+var ErrUnsupportedKeystore = errors.New("unsupported keystore")
+
+// ScryptParams are the parameters of the scrypt key derivation.
+type ScryptParams struct {
+	N    int    `json:"n"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+	Salt string `json:"salt"`
+}
+
+// Keystore is an encrypted seed.
+type Keystore struct {
+	Version    int          `json:"version"`
+	KDF        string       `json:"kdf"`
+	KDFParams  ScryptParams `json:"kdf_params"`
+	Cipher     string       `json:"cipher"`
+	Nonce      string       `json:"nonce"`
+	Ciphertext string       `json:"ciphertext"`
+}
+
+// Encrypt encrypts the given seed with a key derived from the given passphrase.
+func Encrypt(seed string, passphrase string) (*Keystore, error) {
+	if !guards.IsTrytesOfExactLength(seed, consts.HashTrytesSize) {
+		return nil, errors.Wrap(ErrInvalidSeed, "seed must be 81 trytes")
+	}
+	if passphrase == "" {
+		return nil, ErrNoPassphrase
+	}
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	params := ScryptParams{N: scryptN, R: scryptR, P: scryptP, Salt: hex.EncodeToString(salt)}
+	aead, err := newAEAD(passphrase, params)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	ciphertext := aead.Seal(nil, nonce, []byte(seed), nil)
+	return &Keystore{
+		Version: Version, KDF: kdfScrypt, KDFParams: params, Cipher: cipherAESGCM,
+		Nonce: hex.EncodeToString(nonce), Ciphertext: hex.EncodeToString(ciphertext),
+	}, nil
+}
+
+// Decrypt decrypts the seed with a key derived from the given passphrase.
+func (ks *Keystore) Decrypt(passphrase string) (string, error) {
+	if ks.Version != Version || ks.KDF != kdfScrypt || ks.Cipher != cipherAESGCM {
+		return "", errors.Wrapf(ErrUnsupportedKeystore, "version %d, kdf %s, cipher %s", ks.Version, ks.KDF, ks.Cipher)
+	}
+	nonce, err := hex.DecodeString(ks.Nonce)
+	if err != nil {
+		return "", errors.Wrap(err, "invalid nonce")
+	}
+	ciphertext, err := hex.DecodeString(ks.Ciphertext)
+	if err != nil {
+		return "", errors.Wrap(err, "invalid ciphertext")
+	}
+	aead, err := newAEAD(passphrase, ks.KDFParams)
+	if err != nil {
+		return "", err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return "", errors.Wrap(ErrUnsupportedKeystore, "invalid nonce size")
+	}
+	seed, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", ErrWrongPassphrase
+	}
+	return string(seed), nil
+}
+
+func newAEAD(passphrase string, params ScryptParams) (cipher.AEAD, error) {
+	salt, err := hex.DecodeString(params.Salt)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid salt")
+	}
+	key, err := scrypt.Key([]byte(passphrase), salt, params.N, params.R, params.P, scryptKeyLen)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to derive key")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// WriteFile writes the keystore to the file at the given path, readable only by the owner.
+func WriteFile(path string, ks *Keystore) error {
+	ksBytes, err := json.MarshalIndent(ks, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, ksBytes, 0600)
+}
+
+// ReadFile reads the keystore from the file at the given path.
+func ReadFile(path string) (*Keystore, error) {
+	ksBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	ks := &Keystore{}
+	if err := json.Unmarshal(ksBytes, ks); err != nil {
+		return nil, errors.Wrapf(err, "unable to decode keystore %s", path)
+	}
+	return ks, nil
+}
+
+// Open reads the keystore at the given path and decrypts the seed with the passphrase
+// obtained from the given function.
+func Open(path string, passphrase func() (string, error)) (string, error) {
+	ks, err := ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	pass, err := passphrase()
+	if err != nil {
+		return "", err
+	}
+	seed, err := ks.Decrypt(pass)
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to decrypt keystore %s", path)
+	}
+	return seed, nil
+}
+
+// Passphrase returns the passphrase from the PassphraseEnv environment variable, the given file
+// or, if neither is set, asks for it on the terminal.
+func Passphrase(file string) (string, error) {
+	if pass := os.Getenv(PassphraseEnv); pass != "" {
+		return pass, nil
+	}
+	if file != "" {
+		passBytes, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", errors.Wrapf(err, "unable to read passphrase file %s", file)
+		}
+		pass := strings.TrimRight(string(passBytes), "\r\n")
+		if pass == "" {
+			return "", errors.Wrapf(ErrNoPassphrase, "passphrase file %s is empty", file)
+		}
+		return pass, nil
+	}
+	return Prompt("keystore passphrase: ")
+}
+
+// Prompt asks for a passphrase on the terminal without echoing it.
+func Prompt(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(fd) {
+		return "", errors.Wrapf(ErrNoPassphrase, "set %s, configure a passphrase file or run interactively", PassphraseEnv)
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	passBytes, err := terminal.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	if len(passBytes) == 0 {
+		return "", ErrNoPassphrase
+	}
+	return string(passBytes), nil
+}
+
+// NewPassphrase returns the passphrase from the PassphraseEnv environment variable or the given file
+// like Passphrase, but asks twice on the terminal to rule out typos.
+func NewPassphrase(file string) (string, error) {
+	if os.Getenv(PassphraseEnv) != "" || file != "" {
+		return Passphrase(file)
+	}
+	pass, err := Prompt("new keystore passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	confirm, err := Prompt("repeat passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if pass != confirm {
+		return "", errors.New("passphrases don't match")
+	}
+	return pass, nil
+}
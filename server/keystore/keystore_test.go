@@ -0,0 +1,82 @@
+package keystore
+
+import (
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var seed = strings.Repeat("SEED", 20) + "9"
+
+func TestEncryptDecrypt(t *testing.T) {
+	ks, err := Encrypt(seed, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(ks.Ciphertext, seed) {
+		t.Fatal("ciphertext contains the seed")
+	}
+
+	dir, err := ioutil.TempDir("", "keystore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "seed.json")
+	if err := WriteFile(path, ks); err != nil {
+		t.Fatal(err)
+	}
+	decrypted, err := Open(path, func() (string, error) { return "correct horse", nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decrypted != seed {
+		t.Fatalf("expected the decrypted seed to be %s, got %s", seed, decrypted)
+	}
+}
+
+func TestEncryptInvalidInput(t *testing.T) {
+	if _, err := Encrypt("NOT9A9SEED", "correct horse"); errors.Cause(err) != ErrInvalidSeed {
+		t.Fatalf("expected %v, got %v", ErrInvalidSeed, err)
+	}
+	if _, err := Encrypt(seed, ""); errors.Cause(err) != ErrNoPassphrase {
+		t.Fatalf("expected %v, got %v", ErrNoPassphrase, err)
+	}
+}
+
+func TestDecryptWrongPassphrase(t *testing.T) {
+	ks, err := Encrypt(seed, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Decrypt("battery staple"); errors.Cause(err) != ErrWrongPassphrase {
+		t.Fatalf("expected %v, got %v", ErrWrongPassphrase, err)
+	}
+}
+
+func TestDecryptUnsupported(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(ks *Keystore)
+	}{
+		{name: "version", modify: func(ks *Keystore) { ks.Version = Version + 1 }},
+		{name: "kdf", modify: func(ks *Keystore) { ks.KDF = "pbkdf2" }},
+		{name: "cipher", modify: func(ks *Keystore) { ks.Cipher = "aes-128-ctr" }},
+	}
+	ks, err := Encrypt(seed, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			modified := *ks
+			test.modify(&modified)
+			if _, err := modified.Decrypt("correct horse"); errors.Cause(err) != ErrUnsupportedKeystore {
+				t.Fatalf("expected %v, got %v", ErrUnsupportedKeystore, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package metrics
+
+import (
+	"github.com/labstack/echo"
+	"strconv"
+	"time"
+)
+
+// EchoMiddleware records the count and latency of the HTTP requests handled by echo.
+// Requests are labeled by their route instead of their path to keep the label cardinality bounded.
+func EchoMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		start := time.Now()
+		err := next(c)
+		if err != nil {
+			// let the error handler write the response so that the final status code is recorded
+			c.Error(err)
+		}
+		method, route := c.Request().Method, c.Path()
+		HTTPRequestDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+		HTTPRequests.WithLabelValues(method, route, strconv.Itoa(c.Response().Status)).Inc()
+		return nil
+	}
+}
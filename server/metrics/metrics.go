@@ -0,0 +1,152 @@
+// Package metrics defines the Prometheus metrics exposed by the server.
+package metrics
+
+import (
+	"github.com/iotaledger/iota.go/account"
+	"github.com/iotaledger/iota.go/account/deposit"
+	"github.com/prometheus/client_golang/prometheus"
+	"time"
+)
+
+const namespace = "donapoc"
+
+// account operations whose latency is observed
+const (
+	OpAllocateDepositAddress = "allocate_deposit_address"
+	OpAvailableBalance       = "available_balance"
+	OpTotalBalance           = "total_balance"
+)
+
+var (
+	// AccountEvents counts the events emitted by the account, labeled by tenant and event.
+	AccountEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "account",
+		Name:      "events_total",
+		Help:      "Events emitted by the account.",
+	}, []string{"tenant", "event"})
+
+	// AccountOpDuration observes the latency of account operations, labeled by tenant and operation.
+	AccountOpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "account",
+		Name:      "operation_duration_seconds",
+		Help:      "Latency of account operations.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 12),
+	}, []string{"tenant", "operation", "result"})
+
+	// WebsocketClients is the number of connected websocket clients, labeled by tenant.
+	WebsocketClients = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "websocket",
+		Name:      "clients",
+		Help:      "Connected websocket clients.",
+	}, []string{"tenant"})
+
+	// WebsocketSlowClients counts the messages dropped for and the clients disconnected because
+	// their send queue was full, labeled by tenant and action.
+	WebsocketSlowClients = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "websocket",
+		Name:      "slow_clients_total",
+		Help:      "Messages dropped for and clients disconnected because they fell behind.",
+	}, []string{"tenant", "action"})
+
+	// HTTPRequests counts the handled HTTP requests, labeled by method, route and status code.
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Handled HTTP requests.",
+	}, []string{"method", "route", "code"})
+
+	// HTTPRequestDuration observes the latency of HTTP requests, labeled by method and route.
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of HTTP requests.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+)
+
+// NewRegistry creates a registry holding all server metrics, the Go runtime and process metrics.
+func NewRegistry() *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		AccountEvents, AccountOpDuration, WebsocketClients, WebsocketSlowClients, HTTPRequests, HTTPRequestDuration,
+	)
+	return reg
+}
+
+func observe(tenant string, op string, start time.Time, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	AccountOpDuration.WithLabelValues(tenant, op, result).Observe(time.Since(start).Seconds())
+}
+
+// InstrumentAccount wraps the given account so that the latency of
+// deposit address allocations and balance queries is observed.
+func InstrumentAccount(acc account.Account, tenant string) account.Account {
+	return &instrumentedAccount{Account: acc, tenant: tenant}
+}
+
+type instrumentedAccount struct {
+	account.Account
+	tenant string
+}
+
+func (acc *instrumentedAccount) AllocateDepositAddress(conds *deposit.Conditions) (*deposit.CDA, error) {
+	start := time.Now()
+	cda, err := acc.Account.AllocateDepositAddress(conds)
+	observe(acc.tenant, OpAllocateDepositAddress, start, err)
+	return cda, err
+}
+
+func (acc *instrumentedAccount) AvailableBalance() (uint64, error) {
+	start := time.Now()
+	balance, err := acc.Account.AvailableBalance()
+	observe(acc.tenant, OpAvailableBalance, start, err)
+	return balance, err
+}
+
+func (acc *instrumentedAccount) TotalBalance() (uint64, error) {
+	start := time.Now()
+	balance, err := acc.Account.TotalBalance()
+	observe(acc.tenant, OpTotalBalance, start, err)
+	return balance, err
+}
+
+var balanceDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "account", "balance_iotas"),
+	"Balance of the account in iotas.", []string{"tenant", "kind"}, nil,
+)
+
+// NewBalanceCollector creates a collector which queries the usable and total balance
+// of the given accounts (by tenant) whenever the metrics are scraped.
+func NewBalanceCollector(accounts func() map[string]account.Account) prometheus.Collector {
+	return &balanceCollector{accounts: accounts}
+}
+
+type balanceCollector struct {
+	accounts func() map[string]account.Account
+}
+
+func (bc *balanceCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- balanceDesc
+}
+
+func (bc *balanceCollector) Collect(ch chan<- prometheus.Metric) {
+	for tenant, acc := range bc.accounts() {
+		if usable, err := acc.AvailableBalance(); err == nil {
+			ch <- prometheus.MustNewConstMetric(balanceDesc, prometheus.GaugeValue, float64(usable), tenant, "usable")
+		}
+		if total, err := acc.TotalBalance(); err == nil {
+			ch <- prometheus.MustNewConstMetric(balanceDesc, prometheus.GaugeValue, float64(total), tenant, "total")
+		}
+	}
+}
@@ -0,0 +1,181 @@
+// Package price provides the price of IOTA in fiat currencies.
+package price
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrUnknownCurrency = errors.New("unknown currency")
+var ErrNoRates = errors.New("no recent rates available")
+
+// Rates maps an upper case currency code (e.g. "USD") to the price of one Mi (1'000'000 iotas).
+type Rates map[string]float64
+
+// Source is a source of IOTA prices.
+type Source interface {
+	// Rates returns the current prices of one Mi in the given currencies.
+	Rates(currencies []string) (Rates, error)
+}
+
+// StaticSource is a Source with fixed prices.
+type StaticSource Rates
+
+func (s StaticSource) Rates(currencies []string) (Rates, error) {
+	return pick(Rates(s), currencies)
+}
+
+// NewFileSource creates a Source which reads the prices from a JSON file of the form {"USD": 0.3, "EUR": 0.27}.
+// The file is read on every call, so it can be updated while the server is running.
+func NewFileSource(path string) *FileSource {
+	return &FileSource{path: path}
+}
+
+// FileSource is a Source backed by a JSON file.
+type FileSource struct {
+	path string
+}
+
+func (fs *FileSource) Rates(currencies []string) (Rates, error) {
+	fileBytes, err := ioutil.ReadFile(fs.path)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read price file")
+	}
+	rates := Rates{}
+	if err := json.Unmarshal(fileBytes, &rates); err != nil {
+		return nil, errors.Wrap(err, "unable to parse price file")
+	}
+	return pick(rates, currencies)
+}
+
+const coinGeckoURL = "https://api.coingecko.com/api/v3/simple/price?ids=iota&vs_currencies=%s"
+
+// NewCoinGeckoSource creates a Source which queries the CoinGecko API.
+func NewCoinGeckoSource(timeout time.Duration) *CoinGeckoSource {
+	return &CoinGeckoSource{client: &http.Client{Timeout: timeout}}
+}
+
+// CoinGeckoSource is a Source which queries the CoinGecko API.
+type CoinGeckoSource struct {
+	client *http.Client
+}
+
+func (cg *CoinGeckoSource) Rates(currencies []string) (Rates, error) {
+	res, err := cg.client.Get(fmt.Sprintf(coinGeckoURL, strings.ToLower(strings.Join(currencies, ","))))
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to query CoinGecko")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("CoinGecko responded with status %d", res.StatusCode)
+	}
+	body := map[string]map[string]float64{}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return nil, errors.Wrap(err, "unable to parse CoinGecko response")
+	}
+	// CoinGecko's price is per MIOTA which is one Mi
+	rates := Rates{}
+	for currency, rate := range body["iota"] {
+		rates[strings.ToUpper(currency)] = rate
+	}
+	return pick(rates, currencies)
+}
+
+func pick(rates Rates, currencies []string) (Rates, error) {
+	picked := Rates{}
+	for _, currency := range currencies {
+		rate, ok := rates[currency]
+		if !ok {
+			return nil, errors.Wrapf(ErrUnknownCurrency, "no price for %s", currency)
+		}
+		picked[currency] = rate
+	}
+	return picked, nil
+}
+
+// the longest time to wait before retrying a failed fetch
+const maxRetryInterval = time.Duration(30) * time.Second
+
+// NewCache creates a new Cache which holds the rates of the given source for the given ttl.
+// If the source fails, the last known rates are served until they are older than maxAge, 0 serves them indefinitely.
+func NewCache(src Source, currencies []string, ttl time.Duration, maxAge time.Duration) *Cache {
+	retryInterval := ttl
+	if retryInterval > maxRetryInterval {
+		retryInterval = maxRetryInterval
+	}
+	return &Cache{src: src, currencies: currencies, ttl: ttl, maxAge: maxAge, retryInterval: retryInterval}
+}
+
+// Cache caches the rates of a Source. If the Source fails, the last known rates are returned.
+// Only one fetch is done at a time and a failed fetch is only retried after a short interval,
+// so that callers aren't held up by a slow or failing source.
+type Cache struct {
+	src           Source
+	currencies    []string
+	ttl           time.Duration
+	maxAge        time.Duration
+	retryInterval time.Duration
+	mu            sync.Mutex
+	rates         Rates
+	fetchedAt     time.Time
+	attemptedAt   time.Time
+	lastErr       error
+	// closed once the pending fetch finished, nil if none is pending
+	fetching chan struct{}
+}
+
+// Rates returns the cached rates, refreshing them from the source once they are older than the ttl.
+// Callers only wait for a pending fetch if there are no rates to serve in the meantime.
+func (c *Cache) Rates() (Rates, time.Time, error) {
+	c.mu.Lock()
+	if c.rates != nil && time.Since(c.fetchedAt) < c.ttl {
+		defer c.mu.Unlock()
+		return c.rates, c.fetchedAt, nil
+	}
+	switch {
+	case c.fetching == nil && time.Since(c.attemptedAt) >= c.retryInterval:
+		c.fetching = make(chan struct{})
+		c.attemptedAt = time.Now()
+		c.mu.Unlock()
+		c.fetch()
+	case c.fetching != nil && c.rates == nil:
+		fetching := c.fetching
+		c.mu.Unlock()
+		<-fetching
+	default:
+		c.mu.Unlock()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.rates == nil {
+		if c.lastErr != nil {
+			return nil, time.Time{}, c.lastErr
+		}
+		return nil, time.Time{}, ErrNoRates
+	}
+	if c.maxAge != 0 && time.Since(c.fetchedAt) > c.maxAge {
+		return nil, time.Time{}, errors.Wrapf(ErrNoRates, "last rates fetched at %s", c.fetchedAt.Format(time.RFC3339))
+	}
+	// serve stale rates instead of none
+	return c.rates, c.fetchedAt, nil
+}
+
+// fetch queries the source outside of the lock and completes the pending fetch.
+func (c *Cache) fetch() {
+	rates, err := c.src.Rates(c.currencies)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err == nil {
+		c.rates, c.fetchedAt = rates, time.Now()
+	}
+	c.lastErr = err
+	close(c.fetching)
+	c.fetching = nil
+}
@@ -0,0 +1,194 @@
+package price
+
+import (
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSource returns its rates or its error after the delay and counts the calls.
+type fakeSource struct {
+	rates Rates
+	err   error
+	delay time.Duration
+	calls int
+}
+
+func (fs *fakeSource) Rates(currencies []string) (Rates, error) {
+	fs.calls++
+	time.Sleep(fs.delay)
+	if fs.err != nil {
+		return nil, fs.err
+	}
+	return pick(fs.rates, currencies)
+}
+
+func TestCacheTTL(t *testing.T) {
+	src := &fakeSource{rates: Rates{"USD": 0.3}}
+	cache := NewCache(src, []string{"USD"}, time.Hour, 0)
+	for i := 0; i < 3; i++ {
+		rates, _, err := cache.Rates()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rates["USD"] != 0.3 {
+			t.Fatalf("expected rate 0.3, got %v", rates["USD"])
+		}
+	}
+	if src.calls != 1 {
+		t.Fatalf("expected the source to be queried once within the ttl, got %d calls", src.calls)
+	}
+
+	cache = NewCache(src, []string{"USD"}, time.Nanosecond, 0)
+	src.calls = 0
+	for i := 0; i < 2; i++ {
+		time.Sleep(time.Millisecond)
+		if _, _, err := cache.Rates(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if src.calls != 2 {
+		t.Fatalf("expected the source to be queried after the ttl expired, got %d calls", src.calls)
+	}
+}
+
+func TestCacheStaleFallback(t *testing.T) {
+	src := &fakeSource{err: errors.New("unavailable")}
+	cache := NewCache(src, []string{"USD"}, time.Nanosecond, 0)
+	if _, _, err := cache.Rates(); err == nil {
+		t.Fatal("expected an error without any known rates")
+	}
+
+	src.err, src.rates = nil, Rates{"USD": 0.3}
+	_, fetchedAt, err := cache.Rates()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src.err = errors.New("unavailable")
+	time.Sleep(time.Millisecond)
+	rates, at, err := cache.Rates()
+	if err != nil {
+		t.Fatalf("expected the stale rates instead of an error, got %v", err)
+	}
+	if rates["USD"] != 0.3 || !at.Equal(fetchedAt) {
+		t.Fatalf("expected the stale rates fetched at %v, got %v at %v", fetchedAt, rates, at)
+	}
+}
+
+func TestCacheRetryInterval(t *testing.T) {
+	src := &fakeSource{err: errors.New("unavailable")}
+	cache := NewCache(src, []string{"USD"}, time.Hour, 0)
+	for i := 0; i < 3; i++ {
+		if _, _, err := cache.Rates(); err == nil {
+			t.Fatal("expected an error without any known rates")
+		}
+	}
+	if src.calls != 1 {
+		t.Fatalf("expected a failed fetch to not be retried right away, got %d calls", src.calls)
+	}
+}
+
+func TestCacheMaxAge(t *testing.T) {
+	src := &fakeSource{rates: Rates{"USD": 0.3}}
+	cache := NewCache(src, []string{"USD"}, time.Nanosecond, time.Millisecond*10)
+	if _, _, err := cache.Rates(); err != nil {
+		t.Fatal(err)
+	}
+	src.err = errors.New("unavailable")
+	time.Sleep(time.Millisecond)
+	if _, _, err := cache.Rates(); err != nil {
+		t.Fatalf("expected the stale rates within the max age, got %v", err)
+	}
+	time.Sleep(time.Millisecond * 20)
+	if _, _, err := cache.Rates(); errors.Cause(err) != ErrNoRates {
+		t.Fatalf("expected %v beyond the max age, got %v", ErrNoRates, err)
+	}
+}
+
+func TestCacheSingleFetch(t *testing.T) {
+	src := &fakeSource{rates: Rates{"USD": 0.3}, delay: time.Millisecond * 50}
+	cache := NewCache(src, []string{"USD"}, time.Hour, 0)
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if rates, _, err := cache.Rates(); err != nil || rates["USD"] != 0.3 {
+				t.Errorf("expected rate 0.3, got %v (%v)", rates["USD"], err)
+			}
+		}()
+	}
+	wg.Wait()
+	if src.calls != 1 {
+		t.Fatalf("expected concurrent callers to share one fetch, got %d calls", src.calls)
+	}
+
+	// stale rates are served while the refresh is pending
+	cache = NewCache(src, []string{"USD"}, time.Millisecond, 0)
+	if _, _, err := cache.Rates(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond * 2)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cache.Rates()
+	}()
+	time.Sleep(time.Millisecond * 10)
+	start := time.Now()
+	if _, _, err := cache.Rates(); err != nil {
+		t.Fatal(err)
+	}
+	if waited := time.Since(start); waited > time.Millisecond*25 {
+		t.Fatalf("expected the stale rates without waiting for the pending fetch, waited %v", waited)
+	}
+	<-done
+}
+
+func TestFileSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "price")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "prices.json")
+	src := NewFileSource(path)
+
+	if _, err := src.Rates([]string{"USD"}); err == nil {
+		t.Fatal("expected an error for a missing file")
+	}
+
+	if err := ioutil.WriteFile(path, []byte(`{"USD": 0.3, "EUR": 0.27}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	rates, err := src.Rates([]string{"USD", "EUR"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rates["USD"] != 0.3 || rates["EUR"] != 0.27 {
+		t.Fatalf("unexpected rates %v", rates)
+	}
+	if _, err := src.Rates([]string{"CHF"}); errors.Cause(err) != ErrUnknownCurrency {
+		t.Fatalf("expected %v, got %v", ErrUnknownCurrency, err)
+	}
+
+	// the file is read on every call
+	if err := ioutil.WriteFile(path, []byte(`{"USD": 0.5}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if rates, err = src.Rates([]string{"USD"}); err != nil || rates["USD"] != 0.5 {
+		t.Fatalf("expected the updated rate 0.5, got %v (%v)", rates["USD"], err)
+	}
+
+	if err := ioutil.WriteFile(path, []byte(`not json`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := src.Rates([]string{"USD"}); err == nil {
+		t.Fatal("expected an error for an invalid file")
+	}
+}
@@ -1,19 +1,35 @@
 package routers
 
 import (
+	"context"
 	"github.com/gorilla/websocket"
+	"github.com/iotaledger/iota.go/account/deposit"
 	"github.com/iotaledger/iota.go/account/event/listener"
 	"github.com/labstack/echo"
 	"github.com/luca-moser/donapoc/server/controllers"
+	"github.com/luca-moser/donapoc/server/price"
+	"github.com/luca-moser/donapoc/server/server/config"
+	"github.com/luca-moser/donapoc/server/storage"
+	"github.com/pkg/errors"
+	"math"
 	"net/http"
-	"sync"
+	"strconv"
 	"time"
 )
 
+const visitorSessionCookie = "donapoc_session"
+
 type AccRouter struct {
-	WebEngine *echo.Echo           `inject:""`
-	Dev       bool                 `inject:"dev"`
-	AccCtrl   *controllers.AccCtrl `inject:""`
+	WebEngine *echo.Echo             `inject:""`
+	Dev       bool                   `inject:"dev"`
+	AccCtrl   *controllers.AccCtrl   `inject:""`
+	PriceCtrl *controllers.PriceCtrl `inject:""`
+	Config    *config.Configuration  `inject:""`
+	// path prefix of the routes, used to mount tenant accounts
+	Prefix string
+
+	// connected websocket clients
+	hub *wsHub
 }
 
 type balance struct {
@@ -33,6 +49,10 @@ const (
 	MsgReceivedMessage
 	MsgError
 	MsgBalance
+	MsgSweep
+	MsgGoalProgress
+	MsgGoalReached
+	MsgNewDonationAddress
 )
 
 type wsmsg struct {
@@ -46,15 +66,41 @@ var (
 )
 
 type balancemsg struct {
-	Usable uint64 `json:"usable"`
-	Total  uint64 `json:"total"`
+	Usable uint64          `json:"usable"`
+	Total  uint64          `json:"total"`
+	Fiat   *fiatbalancemsg `json:"fiat,omitempty"`
+}
+
+type fiatbalancemsg struct {
+	Usable  map[string]float64 `json:"usable"`
+	Total   map[string]float64 `json:"total"`
+	RatesAt time.Time          `json:"rates_at"`
+}
+
+// newBalanceMsg creates a balance message which includes the fiat values if a price is available.
+func newBalanceMsg(priceCtrl *controllers.PriceCtrl, usable uint64, total uint64) balancemsg {
+	msg := balancemsg{Usable: usable, Total: total}
+	if !priceCtrl.Enabled() {
+		return msg
+	}
+	usableFiat, err := priceCtrl.FiatValues(usable)
+	if err != nil {
+		return msg
+	}
+	totalFiat, err := priceCtrl.FiatValues(total)
+	if err != nil {
+		return msg
+	}
+	msg.Fiat = &fiatbalancemsg{Usable: usableFiat.Values, Total: totalFiat.Values, RatesAt: totalFiat.RatesAt}
+	return msg
 }
 
 func (accRouter *AccRouter) Init() {
 
 	acc := accRouter.AccCtrl.Acc
+	priceCtrl := accRouter.PriceCtrl
 	eventMachine := accRouter.AccCtrl.EM
-	g := accRouter.WebEngine.Group("/account")
+	g := accRouter.WebEngine.Group(accRouter.Prefix + "/account")
 
 	// register an event listener for all account events
 	lis := listener.NewChannelEventListener(eventMachine).
@@ -65,27 +111,40 @@ func (accRouter *AccRouter) Init() {
 		RegReceivingDeposits().
 		RegReceivedDeposits().
 		RegReceivedMessages().
-		RegInternalErrors()
+		RegInternalErrors().
+		RegAccountShutdown()
 
 	// hold on to connected websocket clients
-	wsMu := sync.Mutex{}
-	var nextWsId int
-	wses := map[int]*websocket.Conn{}
-
-	sendWsMsg := func(data *wsmsg) {
-		data.TS = time.Now()
-		wsMu.Lock()
-		defer wsMu.Unlock()
-
-		for _, v := range wses {
-			if err := v.WriteJSON(data); err != nil {
-				// TODO: do something
-			}
+	accRouter.hub = newWsHub(accRouter.Config.App.HTTP.Websocket, accRouter.AccCtrl.TenantID)
+	broadcast := accRouter.hub.broadcast
+
+	// sweeps to the cold wallet are emitted by the sweep controller,
+	// the cold wallet address is only shown to operators
+	eventMachine.RegisterListener(func(data interface{}) {
+		if sweep, ok := data.(*storage.Sweep); ok {
+			public := *sweep
+			public.Address = ""
+			data = &public
 		}
-	}
+		broadcast(&wsmsg{MsgType: MsgSweep, Data: data})
+	}, controllers.EventSweep)
+
+	// progress towards the fundraising goal is emitted by the goal controller
+	eventMachine.RegisterListener(func(data interface{}) {
+		broadcast(&wsmsg{MsgType: MsgGoalProgress, Data: data})
+	}, controllers.EventGoalProgress)
+	eventMachine.RegisterListener(func(data interface{}) {
+		broadcast(&wsmsg{MsgType: MsgGoalReached, Data: data})
+	}, controllers.EventGoalReached)
 
-	// send account events to connected websocket clients
+	// shared deposit addresses are rotated in the background by the account controller
+	eventMachine.RegisterListener(func(data interface{}) {
+		broadcast(&wsmsg{MsgType: MsgNewDonationAddress, Data: data})
+	}, controllers.EventConditionsRotated)
+
+	// send account events to connected websocket clients until the account shuts down
 	go func() {
+		defer lis.Close()
 		for {
 			var msg *wsmsg
 			select {
@@ -100,26 +159,35 @@ func (accRouter *AccRouter) Init() {
 			case ev := <-lis.ReceivingDeposit:
 				msg = &wsmsg{MsgType: MsgReceivingDeposit, Data: ev}
 			case ev := <-lis.ReceivedDeposit:
-				usable, err := acc.AvailableBalance()
-				total, err2 := acc.TotalBalance()
-				if err == nil && err2 == nil {
-					sendWsMsg(&wsmsg{MsgType: MsgBalance, Data: balancemsg{usable, total}})
-				}
+				// the balance is queried outside of the event loop as the account
+				// might be awaiting this loop while shutting down
+				go func() {
+					usable, err := acc.AvailableBalance()
+					total, err2 := acc.TotalBalance()
+					if err == nil && err2 == nil {
+						broadcast(&wsmsg{MsgType: MsgBalance, Data: newBalanceMsg(priceCtrl, usable, total)})
+					}
+				}()
 				msg = &wsmsg{MsgType: MsgReceivedDeposit, Data: ev}
 			case ev := <-lis.ReceivedMessage:
 				msg = &wsmsg{MsgType: MsgReceivedMessage, Data: ev}
 			case err := <-lis.InternalError:
 				msg = &wsmsg{MsgType: MsgError, Data: err.Error()}
+			case <-lis.Shutdown:
+				return
 			}
 
-			sendWsMsg(msg)
+			broadcast(msg)
 		}
 	}()
 
 	g.GET("/donation-link", func(c echo.Context) error {
-		cda, err := accRouter.AccCtrl.GenerateNewDonationAddress()
+		cda, err := donationLink(c, accRouter.AccCtrl, priceCtrl, "")
 		if err != nil {
-			sendWsMsg(&wsmsg{MsgType: MsgError, Data: err.Error()})
+			// errors caused by the visitor are none of the other clients' business
+			if !isVisitorError(err) {
+				broadcast(&wsmsg{MsgType: MsgError, Data: err.Error()})
+			}
 			return err
 		}
 		return c.JSON(http.StatusOK, *cda)
@@ -128,52 +196,125 @@ func (accRouter *AccRouter) Init() {
 	g.GET("/balance", func(c echo.Context) error {
 		usable, err := acc.AvailableBalance()
 		if err != nil {
-			sendWsMsg(&wsmsg{MsgType: MsgError, Data: err.Error()})
+			broadcast(&wsmsg{MsgType: MsgError, Data: err.Error()})
 			return err
 		}
 		total, err := acc.TotalBalance()
 		if err != nil {
-			sendWsMsg(&wsmsg{MsgType: MsgError, Data: err.Error()})
+			broadcast(&wsmsg{MsgType: MsgError, Data: err.Error()})
 			return err
 		}
-		return c.JSON(http.StatusOK, balancemsg{usable, total})
+		return c.JSON(http.StatusOK, newBalanceMsg(priceCtrl, usable, total))
 	})
 
 	g.GET("/live", func(c echo.Context) error {
+		// rejected before the upgrade so that the client gets a proper status
+		if accRouter.hub.full() {
+			return c.JSON(http.StatusServiceUnavailable, SimpleMsg{Msg: ErrTooManyClients.Error()})
+		}
 		ws, err := upgrader.Upgrade(c.Response(), c.Request(), nil)
 		if err != nil {
 			return err
 		}
+		// the connection is hijacked, errors can't be sent as response anymore
+		accRouter.hub.serve(ws)
+		return nil
+	})
+}
 
-		// register new websocket connection
-		var thisID int
-		wsMu.Lock()
-		nextWsId++
-		thisID = nextWsId
-		wses[nextWsId] = ws
-		wsMu.Unlock()
-
-		// cleanup up on disconnect
-		defer func() {
-			wsMu.Lock()
-			delete(wses, thisID)
-			wsMu.Unlock()
-			ws.Close()
-		}()
-
-		// loop infinitely
-		for {
-			msg := &wsmsg{}
-			if err := ws.ReadJSON(msg); err != nil {
-				break
-			}
+// Shutdown sends a close frame to every connected websocket client and disconnects them.
+// The account event loop itself terminates once the account is shut down.
+func (accRouter *AccRouter) Shutdown(ctx context.Context) error {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(time.Duration(1) * time.Second)
+	}
+	accRouter.hub.shutdown(deadline)
+	return nil
+}
 
-			switch msg.MsgType {
-			case MsgStop:
-				break
-			}
-		}
+// donationLink returns the deposit address for the given campaign according to the configured donation mode.
+func donationLink(c echo.Context, accCtrl *controllers.AccCtrl, priceCtrl *controllers.PriceCtrl, campaignID string) (*deposit.CDA, error) {
+	if accCtrl.DonationMode() != controllers.DonationModePerVisitor {
+		return accCtrl.GenerateNewDonationAddress(campaignID)
+	}
+	expectedAmount, err := parseExpectedAmount(c, priceCtrl)
+	if err != nil {
+		return nil, err
+	}
+	session, err := visitorSession(c)
+	if err != nil {
+		return nil, err
+	}
+	return accCtrl.GenerateVisitorDonationAddress(campaignID, session, c.RealIP(), expectedAmount)
+}
 
-		return nil
-	})
+// isVisitorError tells whether the given error was caused by the request of the visitor
+// rather than by the server, such errors are only returned to the visitor.
+func isVisitorError(err error) bool {
+	switch errors.Cause(err) {
+	case ErrBadRequest, controllers.ErrTooManyVisitorAddresses, controllers.ErrDonationsClosed:
+		return true
+	}
+	return false
+}
+
+// visitorSession returns the session id of the visitor or assigns a new one via a cookie
+// if the visitor has none or one which wasn't issued by us.
+func visitorSession(c echo.Context) (string, error) {
+	if cookie, err := c.Cookie(visitorSessionCookie); err == nil && controllers.IsVisitorSession(cookie.Value) {
+		return cookie.Value, nil
+	}
+	session, err := controllers.NewVisitorSession()
+	if err != nil {
+		return "", err
+	}
+	c.SetCookie(&http.Cookie{Name: visitorSessionCookie, Value: session, Path: "/", HttpOnly: true})
+	return session, nil
+}
+
+// parseExpectedAmount parses the optional 'expected_amount' query parameter (in iotas) or alternatively
+// the 'fiat_amount' and 'currency' query parameters which are converted to iotas using the current price.
+func parseExpectedAmount(c echo.Context, priceCtrl *controllers.PriceCtrl) (*uint64, error) {
+	raw := c.QueryParam("expected_amount")
+	if raw == "" {
+		return parseFiatAmount(c, priceCtrl)
+	}
+	expectedAmount, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		return nil, errors.Wrap(ErrBadRequest, "invalid expected amount")
+	}
+	if expectedAmount == 0 {
+		return nil, nil
+	}
+	if expectedAmount > controllers.TotalSupply {
+		return nil, errors.Wrap(ErrBadRequest, "expected amount exceeds the total supply")
+	}
+	return &expectedAmount, nil
+}
+
+func parseFiatAmount(c echo.Context, priceCtrl *controllers.PriceCtrl) (*uint64, error) {
+	raw := c.QueryParam("fiat_amount")
+	if raw == "" {
+		return nil, nil
+	}
+	currency := c.QueryParam("currency")
+	if currency == "" {
+		return nil, errors.Wrap(ErrBadRequest, "fiat amount without currency")
+	}
+	fiatAmount, err := strconv.ParseFloat(raw, 64)
+	if err != nil || fiatAmount < 0 || math.IsInf(fiatAmount, 0) || math.IsNaN(fiatAmount) {
+		return nil, errors.Wrap(ErrBadRequest, "invalid fiat amount")
+	}
+	if fiatAmount == 0 {
+		return nil, nil
+	}
+	expectedAmount, err := priceCtrl.Iotas(fiatAmount, currency)
+	if err != nil {
+		if cause := errors.Cause(err); cause == price.ErrUnknownCurrency || cause == controllers.ErrAmountExceedsSupply {
+			return nil, errors.Wrap(ErrBadRequest, err.Error())
+		}
+		return nil, err
+	}
+	return &expectedAmount, nil
 }
@@ -0,0 +1,217 @@
+package routers
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo"
+	"github.com/luca-moser/donapoc/server/controllers"
+	"github.com/luca-moser/donapoc/server/server/config"
+	"github.com/luca-moser/donapoc/server/statefile"
+	"github.com/luca-moser/donapoc/server/utilities"
+	"github.com/pkg/errors"
+	"gopkg.in/inconshreveable/log15.v2"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// context key under which the authenticated operator is stored
+const adminActorKey = "admin_actor"
+
+const defaultJWTMaxLifetime = time.Duration(24) * time.Hour
+
+type AdminRouter struct {
+	WebEngine *echo.Echo             `inject:""`
+	Config    *config.Configuration  `inject:""`
+	AdminCtrl *controllers.AdminCtrl `inject:""`
+	logger    log15.Logger
+}
+
+type importmsg struct {
+	Summary         string `json:"summary"`
+	RestartRequired bool   `json:"restart_required"`
+}
+
+type payoutreq struct {
+	Address string `json:"address"`
+	Value   uint64 `json:"value"`
+}
+
+type payoutmsg struct {
+	Bundle string `json:"bundle"`
+	Tail   string `json:"tail"`
+}
+
+func (adminRouter *AdminRouter) Init() {
+	logger, _ := utilities.GetLogger("admin")
+	adminRouter.logger = logger
+
+	adminConf := adminRouter.Config.App.Admin
+	if len(adminConf.Tokens) == 0 && adminConf.JWTSecret == "" {
+		logger.Warn("no admin credentials configured, admin API is disabled")
+		return
+	}
+
+	adminCtrl := adminRouter.AdminCtrl
+	g := adminRouter.Group("/admin")
+
+	g.GET("/state", func(c echo.Context) error {
+		state, err := adminCtrl.State()
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, state)
+	})
+
+	g.GET("/state/export", func(c echo.Context) error {
+		state, err := adminCtrl.ExportState(actor(c))
+		if err != nil {
+			return err
+		}
+		c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", "account-"+state.AccountID+".json"))
+		return c.JSON(http.StatusOK, state)
+	})
+
+	// body: a state file as written by the export, query param: force to import the state of another account
+	g.POST("/state/import", func(c echo.Context) error {
+		state, err := statefile.Read(c.Request().Body)
+		if err != nil {
+			if errors.Cause(err) == statefile.ErrUnsupportedVersion {
+				return err
+			}
+			return errors.Wrap(ErrBadRequest, err.Error())
+		}
+		if err := adminCtrl.ImportState(actor(c), state, c.QueryParam("force") == "true"); err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, importmsg{Summary: state.Summary(), RestartRequired: true})
+	})
+
+	// query param: campaign, empty for the default campaign
+	g.POST("/rotate", func(c echo.Context) error {
+		cda, err := adminCtrl.RotateConditions(actor(c), c.QueryParam("campaign"))
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, cda)
+	})
+
+	g.GET("/pending-transfers", func(c echo.Context) error {
+		transfers, err := adminCtrl.PendingTransfers()
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, transfers)
+	})
+
+	g.POST("/payout", func(c echo.Context) error {
+		req := &payoutreq{}
+		if err := c.Bind(req); err != nil {
+			return errors.Wrap(ErrBadRequest, "invalid payout request")
+		}
+		bndl, err := adminCtrl.Payout(actor(c), req.Address, req.Value)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, payoutmsg{Bundle: bndl[0].Bundle, Tail: bndl[0].Hash})
+	})
+
+	g.GET("/plugins", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, adminCtrl.Plugins())
+	})
+
+	g.POST("/plugins/:name/pause", func(c echo.Context) error {
+		if err := adminCtrl.PausePlugin(actor(c), c.Param("name")); err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, adminCtrl.Plugins())
+	})
+
+	g.POST("/plugins/:name/resume", func(c echo.Context) error {
+		if err := adminCtrl.ResumePlugin(actor(c), c.Param("name")); err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, adminCtrl.Plugins())
+	})
+}
+
+// Group creates a group of routes under the given path which, like the admin API, require admin credentials
+// and log the actions of the operators. Without configured credentials, all requests to it are rejected.
+func (adminRouter *AdminRouter) Group(path string) *echo.Group {
+	return adminRouter.WebEngine.Group(path, adminRouter.authenticate, adminRouter.logActions)
+}
+
+func actor(c echo.Context) string {
+	name, _ := c.Get(adminActorKey).(string)
+	return name
+}
+
+// authenticate accepts a configured API token or a JWT signed with the configured secret
+// as bearer token and stores the name of the operator in the context.
+func (adminRouter *AdminRouter) authenticate(next echo.HandlerFunc) echo.HandlerFunc {
+	adminConf := adminRouter.Config.App.Admin
+	maxLifetime := defaultJWTMaxLifetime
+	if adminConf.JWTMaxLifetime != 0 {
+		maxLifetime = time.Duration(adminConf.JWTMaxLifetime) * time.Second
+	}
+	return func(c echo.Context) error {
+		auth := c.Request().Header.Get(echo.HeaderAuthorization)
+		if !strings.HasPrefix(auth, "Bearer ") {
+			adminRouter.logger.Warn("rejected admin request without credentials", "path", c.Path(), "ip", c.RealIP())
+			return echo.ErrUnauthorized
+		}
+		token := strings.TrimPrefix(auth, "Bearer ")
+
+		for _, t := range adminConf.Tokens {
+			if t.Token != "" && subtle.ConstantTimeCompare([]byte(t.Token), []byte(token)) == 1 {
+				c.Set(adminActorKey, t.Name)
+				return next(c)
+			}
+		}
+
+		if adminConf.JWTSecret != "" {
+			claims := &jwt.StandardClaims{}
+			_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+				if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+					return nil, fmt.Errorf("unexpected signing method %v", t.Header["alg"])
+				}
+				return []byte(adminConf.JWTSecret), nil
+			})
+			if err == nil && claims.Subject != "" && validLifetime(claims, maxLifetime) {
+				c.Set(adminActorKey, claims.Subject)
+				return next(c)
+			}
+		}
+
+		adminRouter.logger.Warn("rejected admin request with invalid credentials", "path", c.Path(), "ip", c.RealIP())
+		return echo.ErrUnauthorized
+	}
+}
+
+// validLifetime tells whether the given claims expire and don't live longer than the given lifetime.
+// The signature and the expiration are already verified by the parser.
+func validLifetime(claims *jwt.StandardClaims, maxLifetime time.Duration) bool {
+	if claims.ExpiresAt == 0 {
+		return false
+	}
+	from := time.Now().Unix()
+	if claims.IssuedAt != 0 && claims.IssuedAt < from {
+		from = claims.IssuedAt
+	}
+	return claims.ExpiresAt-from <= int64(maxLifetime/time.Second)
+}
+
+// logActions logs every admin request together with the operator who issued it.
+func (adminRouter *AdminRouter) logActions(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		err := next(c)
+		req := c.Request()
+		if err != nil {
+			adminRouter.logger.Error("admin action failed", "actor", actor(c), "method", req.Method, "path", req.URL.Path, "err", err)
+			return err
+		}
+		adminRouter.logger.Info("admin action", "actor", actor(c), "method", req.Method, "path", req.URL.Path, "status", c.Response().Status)
+		return nil
+	}
+}
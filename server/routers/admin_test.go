@@ -0,0 +1,30 @@
+package routers
+
+import (
+	"github.com/dgrijalva/jwt-go"
+	"testing"
+	"time"
+)
+
+func TestValidLifetime(t *testing.T) {
+	now := time.Now().Unix()
+	hour := int64(time.Hour / time.Second)
+	tests := []struct {
+		name   string
+		claims jwt.StandardClaims
+		valid  bool
+	}{
+		{name: "without expiration", claims: jwt.StandardClaims{Subject: "op"}},
+		{name: "within lifetime", claims: jwt.StandardClaims{ExpiresAt: now + hour}, valid: true},
+		{name: "beyond lifetime", claims: jwt.StandardClaims{ExpiresAt: now + 25*hour}},
+		{name: "issued within lifetime", claims: jwt.StandardClaims{IssuedAt: now - hour, ExpiresAt: now + hour}, valid: true},
+		{name: "issued beyond lifetime", claims: jwt.StandardClaims{IssuedAt: now - 24*hour, ExpiresAt: now + hour}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if valid := validLifetime(&test.claims, 24*time.Hour); valid != test.valid {
+				t.Fatalf("expected valid to be %v, got %v", test.valid, valid)
+			}
+		})
+	}
+}
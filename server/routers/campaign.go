@@ -0,0 +1,78 @@
+package routers
+
+import (
+	"github.com/labstack/echo"
+	"github.com/luca-moser/donapoc/server/controllers"
+	"github.com/luca-moser/donapoc/server/server/config"
+	"net/http"
+)
+
+type CampaignRouter struct {
+	WebEngine  *echo.Echo              `inject:""`
+	AccCtrl    *controllers.AccCtrl    `inject:""`
+	LedgerCtrl *controllers.LedgerCtrl `inject:""`
+	PriceCtrl  *controllers.PriceCtrl  `inject:""`
+}
+
+func (campaignRouter *CampaignRouter) Init() {
+	accCtrl := campaignRouter.AccCtrl
+	g := campaignRouter.WebEngine.Group("/campaigns")
+
+	g.GET("", func(c echo.Context) error {
+		campaigns := accCtrl.Campaigns()
+		if campaigns == nil {
+			campaigns = []config.CampaignConfig{}
+		}
+		return c.JSON(http.StatusOK, campaigns)
+	})
+
+	g.GET("/:id", func(c echo.Context) error {
+		campaign, err := accCtrl.Campaign(c.Param("id"))
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, campaign)
+	})
+
+	g.GET("/:id/donation-link", func(c echo.Context) error {
+		campaign, err := accCtrl.Campaign(c.Param("id"))
+		if err != nil {
+			return err
+		}
+		cda, err := donationLink(c, accCtrl, campaignRouter.PriceCtrl, campaign.ID)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, *cda)
+	})
+
+	g.GET("/:id/balance", func(c echo.Context) error {
+		campaign, err := accCtrl.Campaign(c.Param("id"))
+		if err != nil {
+			return err
+		}
+		balance, err := campaignRouter.LedgerCtrl.CampaignBalance(campaign.ID)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, balance)
+	})
+
+	// same query params as /account/donations
+	g.GET("/:id/donations", func(c echo.Context) error {
+		campaign, err := accCtrl.Campaign(c.Param("id"))
+		if err != nil {
+			return err
+		}
+		q, page, err := parseDonationQuery(c)
+		if err != nil {
+			return err
+		}
+		q.Campaign = &campaign.ID
+		donations, total, err := campaignRouter.LedgerCtrl.Donations(q)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, donationsmsg{Donations: donations, Total: total, Page: page, Limit: q.Limit})
+	})
+}
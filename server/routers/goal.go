@@ -0,0 +1,24 @@
+package routers
+
+import (
+	"github.com/labstack/echo"
+	"github.com/luca-moser/donapoc/server/controllers"
+	"net/http"
+)
+
+type GoalRouter struct {
+	WebEngine *echo.Echo            `inject:""`
+	GoalCtrl  *controllers.GoalCtrl `inject:""`
+}
+
+func (goalRouter *GoalRouter) Init() {
+	g := goalRouter.WebEngine.Group("/account")
+
+	g.GET("/goal", func(c echo.Context) error {
+		progress, err := goalRouter.GoalCtrl.Progress()
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, progress)
+	})
+}
@@ -0,0 +1,30 @@
+package routers
+
+import (
+	"github.com/labstack/echo"
+	"github.com/luca-moser/donapoc/server/controllers"
+	"net/http"
+)
+
+type HealthRouter struct {
+	WebEngine  *echo.Echo              `inject:""`
+	HealthCtrl *controllers.HealthCtrl `inject:""`
+}
+
+func (healthRouter *HealthRouter) Init() {
+	e := healthRouter.WebEngine
+
+	// liveness: the process is up and serving requests
+	e.GET("/healthz", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, SimpleMsg{Msg: "ok"})
+	})
+
+	// readiness: the account is running and its dependencies answer
+	e.GET("/readyz", func(c echo.Context) error {
+		readiness := healthRouter.HealthCtrl.Readiness()
+		if !readiness.Ready {
+			return c.JSON(http.StatusServiceUnavailable, readiness)
+		}
+		return c.JSON(http.StatusOK, readiness)
+	})
+}
@@ -0,0 +1,228 @@
+package routers
+
+import (
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	"github.com/luca-moser/donapoc/server/metrics"
+	"github.com/luca-moser/donapoc/server/server/config"
+	"github.com/luca-moser/donapoc/server/utilities"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/inconshreveable/log15.v2"
+	"sync"
+	"time"
+)
+
+// defaults of the websocket hub
+const (
+	defaultWsSendQueueSize = 64
+	defaultWsWriteTimeout  = time.Duration(10) * time.Second
+	defaultWsPongTimeout   = time.Duration(60) * time.Second
+	// clients don't send anything but stop messages
+	wsReadLimit = 512
+)
+
+var ErrTooManyClients = errors.New("too many websocket clients")
+var ErrHubClosed = errors.New("websocket hub is closed")
+
+// wsHub delivers messages to the connected websocket clients. Every client has its own bounded send queue
+// drained by a writer goroutine, so that a slow or dead client doesn't hold up the delivery to the others.
+type wsHub struct {
+	tenant        string
+	maxClients    int
+	queueSize     int
+	writeTimeout  time.Duration
+	pongTimeout   time.Duration
+	dropSlow      bool
+	clientsMetric prometheus.Gauge
+	logger        log15.Logger
+
+	mu      sync.Mutex
+	nextID  int
+	clients map[int]*wsClient
+	closed  bool
+}
+
+// wsClient is a websocket connection registered at the hub.
+type wsClient struct {
+	id        int
+	conn      *websocket.Conn
+	send      chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// newWsHub creates a hub for the websocket clients of the given tenant.
+func newWsHub(conf config.WebsocketConfig, tenant string) *wsHub {
+	logger, _ := utilities.GetLogger("ws")
+	if tenant != "" {
+		logger = logger.New("tenant", tenant)
+	}
+	hub := &wsHub{
+		tenant:        tenant,
+		maxClients:    conf.MaxClients,
+		queueSize:     conf.SendQueueSize,
+		writeTimeout:  time.Duration(conf.WriteTimeout) * time.Second,
+		pongTimeout:   time.Duration(conf.PongTimeout) * time.Second,
+		dropSlow:      conf.SlowClientPolicy == config.SlowClientDrop,
+		clientsMetric: metrics.WebsocketClients.WithLabelValues(tenant),
+		logger:        logger,
+		clients:       map[int]*wsClient{},
+	}
+	if hub.queueSize == 0 {
+		hub.queueSize = defaultWsSendQueueSize
+	}
+	if hub.writeTimeout == 0 {
+		hub.writeTimeout = defaultWsWriteTimeout
+	}
+	if hub.pongTimeout == 0 {
+		hub.pongTimeout = defaultWsPongTimeout
+	}
+	return hub
+}
+
+// full tells whether the limit of connected clients is reached.
+func (hub *wsHub) full() bool {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	return hub.maxClients > 0 && len(hub.clients) >= hub.maxClients
+}
+
+// serve registers the given connection and delivers the messages of the hub to it until the connection
+// is closed or fails to answer pings in time.
+func (hub *wsHub) serve(conn *websocket.Conn) {
+	client, err := hub.register(conn)
+	if err != nil {
+		hub.logger.Warn("rejected websocket client", "ip", conn.RemoteAddr(), "err", err)
+		closeMsg := websocket.FormatCloseMessage(websocket.CloseTryAgainLater, err.Error())
+		conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(hub.writeTimeout))
+		conn.Close()
+		return
+	}
+	defer hub.unregister(client)
+	go hub.write(client)
+
+	conn.SetReadLimit(wsReadLimit)
+	conn.SetReadDeadline(time.Now().Add(hub.pongTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(hub.pongTimeout))
+	})
+	for {
+		msg := &wsmsg{}
+		if err := conn.ReadJSON(msg); err != nil {
+			return
+		}
+		if msg.MsgType == MsgStop {
+			return
+		}
+	}
+}
+
+func (hub *wsHub) register(conn *websocket.Conn) (*wsClient, error) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	if hub.closed {
+		return nil, ErrHubClosed
+	}
+	if hub.maxClients > 0 && len(hub.clients) >= hub.maxClients {
+		return nil, ErrTooManyClients
+	}
+	hub.nextID++
+	client := &wsClient{
+		id: hub.nextID, conn: conn,
+		send: make(chan []byte, hub.queueSize), done: make(chan struct{}),
+	}
+	hub.clients[client.id] = client
+	hub.clientsMetric.Inc()
+	return client, nil
+}
+
+func (hub *wsHub) unregister(client *wsClient) {
+	hub.mu.Lock()
+	if _, ok := hub.clients[client.id]; ok {
+		delete(hub.clients, client.id)
+		hub.clientsMetric.Dec()
+	}
+	hub.mu.Unlock()
+	client.close()
+}
+
+// write sends the queued messages and the pings to the given client until it is closed
+// or a write doesn't finish within the write timeout.
+func (hub *wsHub) write(client *wsClient) {
+	ticker := time.NewTicker(hub.pongTimeout * 9 / 10)
+	defer func() {
+		ticker.Stop()
+		// unblocks the reading of the connection
+		client.conn.Close()
+	}()
+	for {
+		select {
+		case data := <-client.send:
+			client.conn.SetWriteDeadline(time.Now().Add(hub.writeTimeout))
+			if err := client.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				hub.logger.Debug("websocket client write failed", "client", client.id, "err", err)
+				return
+			}
+		case <-ticker.C:
+			if err := client.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(hub.writeTimeout)); err != nil {
+				hub.logger.Debug("websocket client ping failed", "client", client.id, "err", err)
+				return
+			}
+		case <-client.done:
+			return
+		}
+	}
+}
+
+// broadcast queues the given message for every connected client without waiting for any of them.
+// Clients whose send queue is full either miss the message or are disconnected, depending on the policy.
+func (hub *wsHub) broadcast(msg *wsmsg) {
+	msg.TS = time.Now()
+	data, err := json.Marshal(msg)
+	if err != nil {
+		hub.logger.Error("unable to encode websocket message", "msg_type", msg.MsgType, "err", err)
+		return
+	}
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	for id, client := range hub.clients {
+		select {
+		case client.send <- data:
+			continue
+		default:
+		}
+		if hub.dropSlow {
+			metrics.WebsocketSlowClients.WithLabelValues(hub.tenant, "dropped").Inc()
+			continue
+		}
+		metrics.WebsocketSlowClients.WithLabelValues(hub.tenant, "disconnected").Inc()
+		hub.logger.Info("disconnecting websocket client which fell behind", "client", id)
+		delete(hub.clients, id)
+		hub.clientsMetric.Dec()
+		client.close()
+	}
+}
+
+// shutdown sends a close frame to every connected client and disconnects them.
+// Clients connecting afterwards are rejected.
+func (hub *wsHub) shutdown(deadline time.Time) {
+	closeMsg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	hub.closed = true
+	for id, client := range hub.clients {
+		client.conn.WriteControl(websocket.CloseMessage, closeMsg, deadline)
+		client.conn.Close()
+		delete(hub.clients, id)
+		hub.clientsMetric.Dec()
+		client.close()
+	}
+}
+
+// close stops the writer of the client.
+func (client *wsClient) close() {
+	client.closeOnce.Do(func() {
+		close(client.done)
+	})
+}
@@ -2,7 +2,10 @@ package routers
 
 import (
 	"fmt"
+	"github.com/iotaledger/iota.go/consts"
 	"github.com/labstack/echo"
+	"github.com/luca-moser/donapoc/server/controllers"
+	"github.com/luca-moser/donapoc/server/statefile"
 	"github.com/pkg/errors"
 	"go.mongodb.org/mongo-driver/mongo"
 	"io/ioutil"
@@ -66,12 +69,30 @@ func (indexRouter *IndexRouter) Init() {
 			message = "internal server error"
 
 			// 404 not found
-		case mongo.ErrNoDocuments:
+		case mongo.ErrNoDocuments, controllers.ErrCampaignNotFound, controllers.ErrGoalNotSet, controllers.ErrPluginNotFound:
 			statusCode = http.StatusNotFound
 			message = "not found"
 
+			// 503 service unavailable
+		case controllers.ErrPriceUnavailable:
+			statusCode = http.StatusServiceUnavailable
+			message = "service unavailable"
+
+			// 429 too many requests
+		case controllers.ErrTooManyVisitorAddresses:
+			statusCode = http.StatusTooManyRequests
+			message = "too many requests"
+
+			// 410 gone
+		case controllers.ErrDonationsClosed:
+			statusCode = http.StatusGone
+			message = "donations are closed"
+
 			// 400 bad request
-		case ErrBadRequest:
+		case ErrBadRequest, controllers.ErrInvalidAddress, controllers.ErrInvalidPayout, controllers.ErrInvalidDepositRequestStatus,
+			controllers.ErrSweepDisabled, controllers.ErrSweepCooldown, controllers.ErrSweepBelowMinimum, controllers.ErrSweepSuspended,
+			statefile.ErrUnsupportedVersion, statefile.ErrAccountMismatch, statefile.ErrInvalidState, consts.ErrInsufficientBalance:
+			statusCode = http.StatusBadRequest
 			message = "bad request"
 
 			// 500 internal server error
@@ -0,0 +1,149 @@
+package routers
+
+import (
+	"github.com/labstack/echo"
+	"github.com/luca-moser/donapoc/server/controllers"
+	"github.com/luca-moser/donapoc/server/storage"
+	"github.com/pkg/errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+
+	defaultDonorWallLimit  = 20
+	maxDonorWallLimit      = 50
+	donorWallMessageLength = 280
+)
+
+type LedgerRouter struct {
+	WebEngine   *echo.Echo              `inject:""`
+	LedgerCtrl  *controllers.LedgerCtrl `inject:""`
+	AdminRouter *AdminRouter            `inject:""`
+	// path prefix of the routes, used to mount tenant accounts
+	Prefix string
+}
+
+type donationsmsg struct {
+	Donations []*storage.Donation `json:"donations"`
+	Total     int64               `json:"total"`
+	Page      int64               `json:"page"`
+	Limit     int64               `json:"limit"`
+}
+
+func (ledgerRouter *LedgerRouter) Init() {
+	g := ledgerRouter.WebEngine.Group(ledgerRouter.Prefix + "/account")
+
+	// query params: page, limit, from, to (RFC3339 or YYYY-MM-DD), min, max (iotas), received (true/false)
+	g.GET("/donations", func(c echo.Context) error {
+		q, page, err := parseDonationQuery(c)
+		if err != nil {
+			return err
+		}
+		donations, total, err := ledgerRouter.LedgerCtrl.Donations(q)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, donationsmsg{Donations: donations, Total: total, Page: page, Limit: q.Limit})
+	})
+
+	// the deposit requests reveal the key indices and the visitor addresses of the account, therefore they are
+	// only served to operators under /admin/deposit-requests instead of next to the public routes under /account
+	admin := ledgerRouter.AdminRouter.Group("/admin" + ledgerRouter.Prefix)
+
+	// query param: status (open, expired or fulfilled), empty for all deposit requests
+	admin.GET("/deposit-requests", func(c echo.Context) error {
+		reqs, err := ledgerRouter.LedgerCtrl.DepositRequests(c.QueryParam("status"))
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, reqs)
+	})
+
+	// public list of the most recent donations and their messages, query param: limit
+	g.GET("/donor-wall", func(c echo.Context) error {
+		var limit int64 = defaultDonorWallLimit
+		if raw := c.QueryParam("limit"); raw != "" {
+			var err error
+			if limit, err = strconv.ParseInt(raw, 10, 64); err != nil || limit < 1 || limit > maxDonorWallLimit {
+				return errors.Wrapf(ErrBadRequest, "limit must be between 1 and %d", maxDonorWallLimit)
+			}
+		}
+		entries, err := ledgerRouter.LedgerCtrl.DonorWall(limit, donorWallMessageLength)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, entries)
+	})
+}
+
+func parseDonationQuery(c echo.Context) (*storage.DonationQuery, int64, error) {
+	q := &storage.DonationQuery{Limit: defaultPageLimit}
+	var page int64 = 1
+	var err error
+
+	if raw := c.QueryParam("page"); raw != "" {
+		if page, err = strconv.ParseInt(raw, 10, 64); err != nil || page < 1 {
+			return nil, 0, errors.Wrap(ErrBadRequest, "invalid page")
+		}
+	}
+	if raw := c.QueryParam("limit"); raw != "" {
+		if q.Limit, err = strconv.ParseInt(raw, 10, 64); err != nil || q.Limit < 1 || q.Limit > maxPageLimit {
+			return nil, 0, errors.Wrapf(ErrBadRequest, "limit must be between 1 and %d", maxPageLimit)
+		}
+	}
+	q.Skip = (page - 1) * q.Limit
+
+	if q.From, err = parseTimeParam(c, "from", false); err != nil {
+		return nil, 0, err
+	}
+	if q.To, err = parseTimeParam(c, "to", true); err != nil {
+		return nil, 0, err
+	}
+	if q.MinValue, err = parseUintParam(c, "min"); err != nil {
+		return nil, 0, err
+	}
+	if q.MaxValue, err = parseUintParam(c, "max"); err != nil {
+		return nil, 0, err
+	}
+	if raw := c.QueryParam("received"); raw != "" {
+		if q.ReceivedOnly, err = strconv.ParseBool(raw); err != nil {
+			return nil, 0, errors.Wrap(ErrBadRequest, "invalid received flag")
+		}
+	}
+	return q, page, nil
+}
+
+// parseTimeParam parses the given query parameter as RFC3339 timestamp or as date. A date denotes the
+// start of the day, or its end if endOfDay is set, so that an upper bound includes the whole day.
+func parseTimeParam(c echo.Context, name string, endOfDay bool) (*time.Time, error) {
+	raw := c.QueryParam(name)
+	if raw == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return &t, nil
+	}
+	if t, err := time.Parse("2006-01-02", raw); err == nil {
+		if endOfDay {
+			t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+		}
+		return &t, nil
+	}
+	return nil, errors.Wrapf(ErrBadRequest, "invalid time for '%s'", name)
+}
+
+func parseUintParam(c echo.Context, name string) (*uint64, error) {
+	raw := c.QueryParam(name)
+	if raw == "" {
+		return nil, nil
+	}
+	v, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		return nil, errors.Wrapf(ErrBadRequest, "invalid value for '%s'", name)
+	}
+	return &v, nil
+}
@@ -0,0 +1,21 @@
+package routers
+
+import (
+	"github.com/labstack/echo"
+	"github.com/luca-moser/donapoc/server/controllers"
+	"github.com/luca-moser/donapoc/server/metrics"
+)
+
+type MetricsRouter struct {
+	WebEngine   *echo.Echo               `inject:""`
+	MetricsCtrl *controllers.MetricsCtrl `inject:""`
+}
+
+func (metricsRouter *MetricsRouter) Init() {
+	if !metricsRouter.MetricsCtrl.Enabled() {
+		return
+	}
+	e := metricsRouter.WebEngine
+	e.Use(metrics.EchoMiddleware)
+	e.GET("/metrics", echo.WrapHandler(metricsRouter.MetricsCtrl.Handler()))
+}
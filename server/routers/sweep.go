@@ -0,0 +1,45 @@
+package routers
+
+import (
+	"github.com/labstack/echo"
+	"github.com/luca-moser/donapoc/server/controllers"
+	"github.com/pkg/errors"
+	"net/http"
+	"strconv"
+)
+
+type SweepRouter struct {
+	WebEngine   *echo.Echo             `inject:""`
+	SweepCtrl   *controllers.SweepCtrl `inject:""`
+	AdminRouter *AdminRouter           `inject:""`
+}
+
+func (sweepRouter *SweepRouter) Init() {
+	// the sweeps reveal the cold wallet address
+	g := sweepRouter.AdminRouter.Group("/admin")
+
+	// query param: limit
+	g.GET("/sweeps", func(c echo.Context) error {
+		var limit int64 = defaultPageLimit
+		if raw := c.QueryParam("limit"); raw != "" {
+			var err error
+			if limit, err = strconv.ParseInt(raw, 10, 64); err != nil || limit < 1 || limit > maxPageLimit {
+				return errors.Wrapf(ErrBadRequest, "limit must be between 1 and %d", maxPageLimit)
+			}
+		}
+		sweeps, err := sweepRouter.SweepCtrl.Sweeps(limit)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, sweeps)
+	})
+
+	// sweeps the usable balance regardless of the threshold and schedule
+	g.POST("/sweep", func(c echo.Context) error {
+		sweep, err := sweepRouter.SweepCtrl.Sweep(controllers.SweepReasonManual)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, sweep)
+	})
+}
@@ -0,0 +1,71 @@
+package routers
+
+import (
+	"context"
+	"fmt"
+	"github.com/labstack/echo"
+	"github.com/luca-moser/donapoc/server/controllers"
+	"github.com/luca-moser/donapoc/server/server/config"
+	"net/http"
+)
+
+type TenantRouter struct {
+	WebEngine   *echo.Echo              `inject:""`
+	Dev         bool                    `inject:"dev"`
+	TenantCtrl  *controllers.TenantCtrl `inject:""`
+	PriceCtrl   *controllers.PriceCtrl  `inject:""`
+	Config      *config.Configuration   `inject:""`
+	AdminRouter *AdminRouter            `inject:""`
+	accRouters  []*AccRouter
+}
+
+type tenantmsg struct {
+	ID      string `json:"id"`
+	Account string `json:"account,omitempty"`
+	Running bool   `json:"running"`
+	Error   string `json:"error,omitempty"`
+}
+
+func (tenantRouter *TenantRouter) Init() {
+	e := tenantRouter.WebEngine
+
+	// mount the account routes of each tenant under /tenants/<id>
+	for _, tenant := range tenantRouter.TenantCtrl.Tenants() {
+		prefix := fmt.Sprintf("/tenants/%s", tenant.ID)
+		if !tenant.Running() {
+			e.Any(prefix+"/*", func(c echo.Context) error {
+				return c.JSON(http.StatusServiceUnavailable, SimpleMsg{Msg: "tenant is not available"})
+			})
+			continue
+		}
+		accRouter := &AccRouter{WebEngine: e, Dev: tenantRouter.Dev, AccCtrl: tenant.AccCtrl, PriceCtrl: tenantRouter.PriceCtrl, Config: tenantRouter.Config, Prefix: prefix}
+		accRouter.Init()
+		tenantRouter.accRouters = append(tenantRouter.accRouters, accRouter)
+		ledgerRouter := &LedgerRouter{WebEngine: e, LedgerCtrl: tenant.LedgerCtrl, AdminRouter: tenantRouter.AdminRouter, Prefix: prefix}
+		ledgerRouter.Init()
+	}
+
+	e.GET("/tenants", func(c echo.Context) error {
+		tenants := tenantRouter.TenantCtrl.Tenants()
+		msgs := make([]tenantmsg, len(tenants))
+		for i, tenant := range tenants {
+			msgs[i] = tenantmsg{ID: tenant.ID, Running: tenant.Running()}
+			if tenant.Running() {
+				msgs[i].Account = tenant.AccCtrl.Acc.ID()
+			} else {
+				msgs[i].Error = tenant.Err.Error()
+			}
+		}
+		return c.JSON(http.StatusOK, msgs)
+	})
+}
+
+// Shutdown disconnects the websocket clients of all tenants.
+func (tenantRouter *TenantRouter) Shutdown(ctx context.Context) error {
+	for _, accRouter := range tenantRouter.accRouters {
+		if err := accRouter.Shutdown(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package routers
+
+import (
+	"github.com/labstack/echo"
+	"github.com/luca-moser/donapoc/server/controllers"
+	"github.com/luca-moser/donapoc/server/storage"
+	"github.com/pkg/errors"
+	"net/http"
+	"strconv"
+)
+
+type WebhookRouter struct {
+	WebEngine   *echo.Echo               `inject:""`
+	WebhookCtrl *controllers.WebhookCtrl `inject:""`
+	AdminRouter *AdminRouter             `inject:""`
+}
+
+func (webhookRouter *WebhookRouter) Init() {
+	// the deliveries contain the signed payloads and the errors of the endpoints
+	g := webhookRouter.AdminRouter.Group("/admin/webhooks")
+
+	// query params: status (pending, delivered or failed), endpoint, limit
+	g.GET("/deliveries", func(c echo.Context) error {
+		q := &storage.DeliveryQuery{Endpoint: c.QueryParam("endpoint"), Limit: defaultPageLimit}
+		switch status := c.QueryParam("status"); status {
+		case "", storage.DeliveryPending, storage.DeliveryDelivered, storage.DeliveryFailed:
+			q.Status = status
+		default:
+			return errors.Wrapf(ErrBadRequest, "invalid status '%s'", status)
+		}
+		if raw := c.QueryParam("limit"); raw != "" {
+			var err error
+			if q.Limit, err = strconv.ParseInt(raw, 10, 64); err != nil || q.Limit < 1 || q.Limit > maxPageLimit {
+				return errors.Wrapf(ErrBadRequest, "limit must be between 1 and %d", maxPageLimit)
+			}
+		}
+		deliveries, err := webhookRouter.WebhookCtrl.Deliveries(q)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, deliveries)
+	})
+}
@@ -0,0 +1,19 @@
+package server
+
+import (
+	"fmt"
+	"github.com/luca-moser/donapoc/server/server/config"
+)
+
+// CheckConfig loads and validates the config and reports all problems found at once.
+func CheckConfig(opts config.Options) error {
+	conf, err := loadConfig(opts)
+	if err != nil {
+		return err
+	}
+	if err := conf.Validate(); err != nil {
+		return err
+	}
+	fmt.Println("config OK")
+	return nil
+}
@@ -1,42 +1,92 @@
 package config
 
 import (
+	"crypto/tls"
 	"encoding/json"
+	"github.com/pkg/errors"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 )
 
+// the environment variable naming the environment whose config overlays are loaded
+const EnvVar = "APP_ENV"
+
+const defaultDir = "./configs"
+
 type Config interface{}
 
 var subConfigs = []Config{&AppConfig{}}
 
-func LoadConfig() *Configuration {
+// Options define where the configuration is loaded from.
+type Options struct {
+	// the directory holding the config files, defaults to "./configs"
+	Dir string
+	// the environment whose overlays (e.g. "app.prod.json" for "prod") are merged over
+	// the base files, defaults to the APP_ENV environment variable
+	Env string
+	// overrides the data directory of the config
+	DataDir string
+}
+
+// LoadConfig loads each sub config from its base file in the config directory, merges the overlay
+// of the environment over it and finally applies the overrides from environment variables,
+// e.g. APP_ACCOUNT_MONGODB_URI for the "uri" of the "mongodb" object of the "account" object of app.json.
+func LoadConfig(opts Options) (*Configuration, error) {
+	if opts.Dir == "" {
+		opts.Dir = defaultDir
+	}
+	if opts.Env == "" {
+		opts.Env = os.Getenv(EnvVar)
+	}
 	configuration := &Configuration{}
 	refConfig := reflect.Indirect(reflect.ValueOf(configuration))
 
 	// go through each sub config, load it and init it on the main struct
-	for _, c := range subConfigs {
+	for _, proto := range subConfigs {
+		// load into a new instance as the slices of an earlier loaded config must not be overwritten
+		c := reflect.New(reflect.TypeOf(proto).Elem()).Interface()
 		// indirect as 'c' is pointer to struct
 		ind := reflect.Indirect(reflect.ValueOf(c))
 		ty := ind.Type()
 		field, _ := ty.FieldByName("Location")
-		fileLocation := field.Tag.Get("loc")
+		fileName := field.Tag.Get("loc")
+		configFieldName := strings.Split(ty.Name(), "Config")[0]
 
-		// read file indicated by the field tag
-		fileBytes, err := ioutil.ReadFile(fileLocation)
-		if err != nil {
-			panic(err)
+		// read the base file indicated by the field tag
+		files := []string{filepath.Join(opts.Dir, fileName)}
+		if opts.Env != "" {
+			ext := filepath.Ext(fileName)
+			overlay := filepath.Join(opts.Dir, strings.TrimSuffix(fileName, ext)+"."+opts.Env+ext)
+			if _, err := os.Stat(overlay); err == nil {
+				files = append(files, overlay)
+			}
 		}
-		if err := json.Unmarshal(fileBytes, c); err != nil {
-			panic(err)
+		for _, file := range files {
+			fileBytes, err := ioutil.ReadFile(file)
+			if err != nil {
+				return nil, errors.Wrap(err, "unable to read config")
+			}
+			if err := json.Unmarshal(fileBytes, c); err != nil {
+				return nil, errors.Wrapf(err, "unable to parse config %s", file)
+			}
+		}
+
+		if err := applyEnv(ind, strings.ToUpper(configFieldName)); err != nil {
+			return nil, err
 		}
 
 		// init configuration struct field with the given config
-		configFieldName := strings.Split(ty.Name(), "Config")[0]
 		refConfig.FieldByName(configFieldName).Set(ind)
 	}
-	return configuration
+
+	if opts.DataDir != "" {
+		configuration.App.DataDir = opts.DataDir
+	}
+	configuration.App.resolvePaths()
+	return configuration, nil
 }
 
 type Configuration struct {
@@ -44,42 +94,214 @@ type Configuration struct {
 }
 
 type AppConfig struct {
-	Location interface{} `loc:"./configs/app.json"`
+	Location interface{} `loc:"app.json"`
 	Name     string
 	Dev      bool
 	Verbose  bool
-	Account  AccountConfig
-	HTTP     WebConfig
+	// the logs, the badger store and other files written by the server are resolved
+	// against this directory, defaults to the working directory
+	DataDir string `json:"data_dir"`
+	Account AccountConfig
+	HTTP    WebConfig
+	Admin   AdminConfig
+}
+
+// DataPath resolves the given relative path against the data directory.
+func (c *AppConfig) DataPath(path string) string {
+	if path == "" || c.DataDir == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(c.DataDir, path)
+}
+
+// resolvePaths resolves the paths of the config under which the server writes data.
+// Paths of files which are only read, like the keystore, are relative to the working directory.
+func (c *AppConfig) resolvePaths() {
+	c.Account.Store.Badger.Dir = c.DataPath(c.Account.Store.Badger.Dir)
+}
+
+// AdminConfig defines the credentials of the admin API. The admin API is disabled if none are configured.
+type AdminConfig struct {
+	// static API tokens, sent as "Authorization: Bearer <token>"
+	Tokens []AdminToken `json:"tokens"`
+	// the HMAC secret of HS256 signed JWTs, the "sub" claim names the operator
+	JWTSecret string `json:"jwt_secret"`
+	// the maximum lifetime in seconds of a JWT, tokens expiring later are rejected, 0 means the default of 24 hours
+	JWTMaxLifetime uint64 `json:"jwt_max_lifetime"`
+}
+
+// AdminToken is a static API token of an operator.
+type AdminToken struct {
+	// the operator name under which actions are logged
+	Name  string `json:"name"`
+	Token string `json:"token"`
 }
 
 type AccountConfig struct {
-	Seed    string `json:"seed"`
-	Quorum  struct {
-		PrimaryNode                string   `json:"primary_node"`
-		Nodes                      []string `json:"nodes"`
-		Threshold                  float64  `json:"threshold"`
-		NoResponseTolerance        float64  `json:"no_response_tolerance"`
-		MaxSubtangleMilestoneDelta uint64   `json:"max_subtangle_milestone_delta"`
-		Timeout                    uint64   `json:"timeout"`
-	} `json:"quorum"`
-	MWM                        uint64 `json:"mwm"`
-	GTTADepth                  uint64 `json:"gtta_depth"`
-	SecurityLevel              uint64 `json:"security_level"`
-	TransferPollInterval       uint64 `json:"transfer_poll_interval"`
-	PromoteReattachInterval    uint64 `json:"promote_reattach_interval"`
-	AddressValidityTimeoutDays uint64 `json:"address_validity_timeout_days"`
+	// plaintext seed, only accepted in dev mode. Use a keystore otherwise.
+	Seed                       string         `json:"seed"`
+	Keystore                   KeystoreConfig `json:"keystore"`
+	Quorum                     QuorumConfig   `json:"quorum"`
+	MWM                        uint64         `json:"mwm"`
+	GTTADepth                  uint64         `json:"gtta_depth"`
+	SecurityLevel              uint64         `json:"security_level"`
+	TransferPollInterval       uint64         `json:"transfer_poll_interval"`
+	PromoteReattach            bool           `json:"promote_reattach"`
+	PromoteReattachInterval    uint64         `json:"promote_reattach_interval"`
+	AddressValidityTimeoutDays uint64         `json:"address_validity_timeout_days"`
+	// how long before its timeout the shared deposit address is replaced by the next one
+	RotationLeadTimeMinutes uint64 `json:"rotation_lead_time_minutes"`
+	// the delay in seconds before a failed allocation of the next shared deposit address is retried
+	RotationRetryInterval uint64 `json:"rotation_retry_interval"`
+	// either "shared" (one multi-use address for all visitors) or "per_visitor"
+	DonationMode                 string `json:"donation_mode"`
+	VisitorAddressTimeoutMinutes uint64 `json:"visitor_address_timeout_minutes"`
+	// the maximum of open per-visitor deposit addresses of a single client (IP), 0 means the default of 5
+	MaxVisitorAddressesPerClient uint64           `json:"max_visitor_addresses_per_client"`
+	Campaigns                    []CampaignConfig `json:"campaigns"`
+	Tenants                      []TenantConfig   `json:"tenants"`
+	Store struct {
+		// either "mongo" (default), "badger" or "memory"
+		Backend string `json:"backend"`
+		Badger  struct {
+			Dir string `json:"dir"`
+		} `json:"badger"`
+	} `json:"store"`
 	MongoDB struct {
 		URI      string `json:"uri"`
 		DBName   string `json:"dbname"`
 		CollName string `json:"collname"`
+		// collection holding the deposit conditions handed out by the server
+		CDACollName string `json:"cda_collname"`
+		// collection holding the ledger of received donations
+		DonationCollName string `json:"donation_collname"`
+		// collection holding the sweeps to the cold wallet
+		SweepCollName string `json:"sweep_collname"`
+		// collection holding the webhook deliveries
+		WebhookCollName string `json:"webhook_collname"`
 	} `json:"mongodb"`
 	Time                       struct {
 		NTPServer string `json:"ntp_server"`
 	} `json:"time"`
+	Sweep    SweepConfig    `json:"sweep"`
+	Price    PriceConfig    `json:"price"`
+	Goal     GoalConfig     `json:"goal"`
+	Webhooks WebhooksConfig `json:"webhooks"`
+}
+
+// WebhooksConfig defines the endpoints which get account events posted and how failed deliveries are retried.
+type WebhooksConfig struct {
+	Endpoints []WebhookConfig `json:"endpoints"`
+	// attempts after which a delivery is given up
+	MaxAttempts int `json:"max_attempts"`
+	// delay in seconds before the first retry, doubled on every further retry
+	RetryDelay uint64 `json:"retry_delay"`
+	// maximum delay in seconds between two retries
+	MaxRetryDelay uint64 `json:"max_retry_delay"`
+	// timeout in seconds of a single delivery request
+	Timeout uint64 `json:"timeout"`
+}
+
+// WebhookConfig defines an endpoint which gets the chosen account events posted.
+type WebhookConfig struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+	// the key of the HMAC-SHA256 signature sent in the X-Donapoc-Signature header
+	Secret string `json:"secret"`
+	// any of "receiving_deposit", "received_deposit", "sent", "confirmed" and "error"
+	Events []string `json:"events"`
+}
+
+// GoalConfig defines the fundraising goal of the account.
+type GoalConfig struct {
+	// the amount of iotas to raise, 0 disables the goal
+	Target uint64 `json:"target"`
+	// RFC3339 timestamp until which the goal should be reached, empty for none
+	Deadline    string `json:"deadline"`
+	Description string `json:"description"`
+	// stop handing out donation links once the goal is reached
+	StopWhenReached bool `json:"stop_when_reached"`
+}
+
+// PriceConfig defines where the fiat price of IOTA is taken from.
+type PriceConfig struct {
+	// either "static", "file" or "coingecko", empty disables fiat values
+	Source string `json:"source"`
+	// the currencies to provide, defaults to USD and EUR
+	Currencies []string `json:"currencies"`
+	// the price of one Mi per currency for the static source
+	Static map[string]float64 `json:"static"`
+	// the JSON file of the file source, holding the price of one Mi per currency
+	File string `json:"file"`
+	// how long in seconds a fetched price is used before it is fetched again
+	CacheTTL uint64 `json:"cache_ttl"`
+	// how old in seconds a price may get while the source fails before fiat amounts are refused, defaults to an hour
+	MaxAge uint64 `json:"max_age"`
+	// timeout in seconds of requests to remote sources
+	Timeout uint64 `json:"timeout"`
+}
+
+// SweepConfig defines when the usable balance of the account is sent to the cold wallet.
+type SweepConfig struct {
+	Enabled bool `json:"enabled"`
+	// the cold wallet address including its checksum
+	Address string `json:"address"`
+	// sweep as soon as the usable balance reaches the threshold, 0 disables the trigger
+	Threshold uint64 `json:"threshold"`
+	// sweep every given amount of seconds, 0 disables the schedule
+	Interval uint64 `json:"interval"`
+	// how often in seconds the usable balance is checked against the threshold
+	CheckInterval uint64 `json:"check_interval"`
+	// sweeps below this amount are not executed
+	MinAmount uint64 `json:"min_amount"`
+	// minimum seconds between two sweeps
+	Cooldown uint64 `json:"cooldown"`
+}
+
+// CampaignConfig defines a donation campaign which has its own rotating deposit address.
+type CampaignConfig struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	// overrides the account wide validity of the campaign's shared deposit address
+	AddressValidityTimeoutDays uint64 `json:"address_validity_timeout_days"`
+}
+
+// TenantConfig defines an additional account hosted by the server.
+// A tenant shares the node, time and store settings of the main account.
+type TenantConfig struct {
+	ID   string `json:"id"`
+	Seed string `json:"seed"`
+	// the keystore file holding the tenant's seed, decrypted with the passphrase of the main keystore
+	Keystore string `json:"keystore"`
+	// the MongoDB collection holding the tenant's account state, defaults to "<collname>_<id>".
+	// the tenant's server data is kept in the server collections suffixed with "_<id>",
+	// badger stores put the tenant's data into "<dir>/tenants/<id>".
+	CollName string `json:"collname"`
+}
+
+// QuorumConfig defines the nodes which are queried and how many of them have to agree.
+type QuorumConfig struct {
+	PrimaryNode                string   `json:"primary_node"`
+	Nodes                      []string `json:"nodes"`
+	Threshold                  float64  `json:"threshold"`
+	NoResponseTolerance        float64  `json:"no_response_tolerance"`
+	MaxSubtangleMilestoneDelta uint64   `json:"max_subtangle_milestone_delta"`
+	// timeout in seconds of the requests to the nodes
+	Timeout uint64 `json:"timeout"`
+}
+
+// KeystoreConfig defines the file holding the encrypted seed. The passphrase is taken from
+// the DONAPOC_KEYSTORE_PASSPHRASE environment variable, the passphrase file or asked for on the terminal.
+type KeystoreConfig struct {
+	File           string `json:"file"`
+	PassphraseFile string `json:"passphrase_file"`
 }
 
 type WebConfig struct {
-	Domain  string
+	// the domain under which the server is reachable, HTTP requests are redirected to it
+	Domain string
+	// the address of the HTTPS listener if TLS is enabled
 	Address string
 	Assets  struct {
 		Static  string
@@ -87,4 +309,69 @@ type WebConfig struct {
 		Favicon string
 	}
 	LogRequests bool
+	// exposes Prometheus metrics under /metrics
+	Metrics   bool
+	TLS       TLSConfig       `json:"tls"`
+	Websocket WebsocketConfig `json:"websocket"`
+}
+
+// slow client policies of the websocket hub
+const (
+	// messages which don't fit into the send queue of a client are dropped for that client
+	SlowClientDrop = "drop"
+	// clients whose send queue is full are disconnected
+	SlowClientDisconnect = "disconnect"
+)
+
+// WebsocketConfig defines how the live account events are delivered to the websocket clients.
+type WebsocketConfig struct {
+	// the maximum of concurrently connected clients per account, 0 disables the limit
+	MaxClients int `json:"max_clients"`
+	// the number of messages queued per client, defaults to 64
+	SendQueueSize int `json:"send_queue_size"`
+	// timeout in seconds of writing a message to a client, defaults to 10
+	WriteTimeout uint64 `json:"write_timeout"`
+	// seconds within which a client must answer a ping before it is disconnected, defaults to 60.
+	// pings are sent in 9/10 of this interval.
+	PongTimeout uint64 `json:"pong_timeout"`
+	// either "disconnect" (default) or "drop", applied to clients whose send queue is full
+	SlowClientPolicy string `json:"slow_client_policy"`
+}
+
+// TLSConfig defines the certificate of the HTTPS listener. TLS is enabled if a certificate is set.
+type TLSConfig struct {
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+	// either "1.0", "1.1", "1.2" or "1.3", defaults to "1.2"
+	MinVersion string `json:"min_version"`
+	// the address of a plain HTTP listener redirecting to HTTPS, e.g. "0.0.0.0:80", empty disables it
+	RedirectAddress string `json:"redirect_address"`
+	// the max-age in seconds of the Strict-Transport-Security header, 0 disables HSTS
+	HSTSMaxAge int `json:"hsts_max_age"`
+	// whether the HSTS policy also applies to subdomains
+	HSTSIncludeSubdomains bool `json:"hsts_include_subdomains"`
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Enabled tells whether the server is served over HTTPS.
+func (c *TLSConfig) Enabled() bool {
+	return c.CertFile != ""
+}
+
+// Version returns the minimum TLS version.
+func (c *TLSConfig) Version() (uint16, error) {
+	if c.MinVersion == "" {
+		return tls.VersionTLS12, nil
+	}
+	version, ok := tlsVersions[c.MinVersion]
+	if !ok {
+		return 0, errors.Errorf("unsupported TLS version '%s'", c.MinVersion)
+	}
+	return version, nil
 }
@@ -0,0 +1,63 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Diff returns the paths of the settings which differ between the given configurations,
+// named after the JSON names of their fields, e.g. "account.quorum.nodes" or "account.campaigns[0].title".
+// Slices which differ in length are reported as a whole.
+func Diff(old *Configuration, new *Configuration) []string {
+	changes := []string{}
+	diffValues(reflect.ValueOf(old.App), reflect.ValueOf(new.App), "", &changes)
+	return changes
+}
+
+func diffValues(old reflect.Value, new reflect.Value, path string, changes *[]string) {
+	switch old.Kind() {
+	case reflect.Struct:
+		ty := old.Type()
+		for i := 0; i < ty.NumField(); i++ {
+			field := ty.Field(i)
+			if field.PkgPath != "" || field.Tag.Get("loc") != "" {
+				continue
+			}
+			name := jsonName(field)
+			if name == "" {
+				continue
+			}
+			if path != "" {
+				name = path + "." + name
+			}
+			diffValues(old.Field(i), new.Field(i), name, changes)
+		}
+	case reflect.Slice:
+		if old.Len() != new.Len() {
+			*changes = append(*changes, path)
+			return
+		}
+		for i := 0; i < old.Len(); i++ {
+			diffValues(old.Index(i), new.Index(i), fmt.Sprintf("%s[%d]", path, i), changes)
+		}
+	default:
+		if !reflect.DeepEqual(old.Interface(), new.Interface()) {
+			*changes = append(*changes, path)
+		}
+	}
+}
+
+// jsonName returns the JSON name of the given field or, for fields without JSON tag, its lower cased name.
+func jsonName(field reflect.StructField) string {
+	if tag := field.Tag.Get("json"); tag != "" {
+		name := strings.Split(tag, ",")[0]
+		if name == "-" {
+			return ""
+		}
+		if name != "" {
+			return name
+		}
+	}
+	return strings.ToLower(field.Name)
+}
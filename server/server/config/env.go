@@ -0,0 +1,154 @@
+package config
+
+import (
+	"github.com/pkg/errors"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// applyEnv overrides the fields of the given struct with the values of the environment variables
+// named after the path of the field: the prefix followed by the upper cased JSON names, e.g. APP_ACCOUNT_SEED.
+// Elements of slices of objects are addressed by their index (APP_ACCOUNT_TENANTS_0_SEED),
+// slices of scalars are comma separated and map entries are addressed by their key (APP_ACCOUNT_PRICE_STATIC_USD).
+func applyEnv(v reflect.Value, prefix string) error {
+	ty := v.Type()
+	for i := 0; i < ty.NumField(); i++ {
+		field := ty.Field(i)
+		if field.PkgPath != "" || field.Tag.Get("loc") != "" {
+			continue
+		}
+		name := envName(field)
+		if name == "" {
+			continue
+		}
+		if err := applyEnvValue(v.Field(i), prefix+"_"+name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func applyEnvValue(v reflect.Value, name string) error {
+	switch v.Kind() {
+	case reflect.Struct:
+		return applyEnv(v, name)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Struct {
+			for i := 0; i < v.Len(); i++ {
+				if err := applyEnv(v.Index(i), name+"_"+strconv.Itoa(i)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	case reflect.Map:
+		return applyEnvMap(v, name)
+	}
+
+	raw, ok := os.LookupEnv(name)
+	if !ok {
+		return nil
+	}
+	if err := setValue(v, raw); err != nil {
+		return errors.Wrapf(err, "invalid value of environment variable %s", name)
+	}
+	return nil
+}
+
+func applyEnvMap(v reflect.Value, name string) error {
+	if v.Type().Key().Kind() != reflect.String {
+		return nil
+	}
+	prefix := name + "_"
+	for _, env := range os.Environ() {
+		kv := strings.SplitN(env, "=", 2)
+		if len(kv) != 2 || !strings.HasPrefix(kv[0], prefix) || len(kv[0]) == len(prefix) {
+			continue
+		}
+		elem := reflect.New(v.Type().Elem()).Elem()
+		if err := setValue(elem, kv[1]); err != nil {
+			return errors.Wrapf(err, "invalid value of environment variable %s", kv[0])
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		v.SetMapIndex(reflect.ValueOf(kv[0][len(prefix):]).Convert(v.Type().Key()), elem)
+	}
+	return nil
+}
+
+// setValue parses the given raw value into the given scalar or slice of scalars.
+func setValue(v reflect.Value, raw string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(raw, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(raw, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		parts := []string{}
+		if raw != "" {
+			parts = strings.Split(raw, ",")
+		}
+		slice := reflect.MakeSlice(v.Type(), len(parts), len(parts))
+		for i, part := range parts {
+			if err := setValue(slice.Index(i), strings.TrimSpace(part)); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+	default:
+		return errors.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// envName returns the upper cased JSON name of the given field or, for fields without JSON tag,
+// its name in upper snake case.
+func envName(field reflect.StructField) string {
+	if tag := field.Tag.Get("json"); tag != "" {
+		name := strings.Split(tag, ",")[0]
+		if name == "-" {
+			return ""
+		}
+		if name != "" {
+			return strings.ToUpper(name)
+		}
+	}
+	var b strings.Builder
+	runes := []rune(field.Name)
+	for i, r := range runes {
+		// a new word starts at an upper case letter following a lower case one
+		// or at the last upper case letter of an acronym followed by a lower case one
+		if i > 0 && unicode.IsUpper(r) &&
+			(unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+			b.WriteRune('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
@@ -0,0 +1,281 @@
+package config
+
+import (
+	"fmt"
+	"github.com/iotaledger/iota.go/api"
+	"github.com/iotaledger/iota.go/consts"
+	"github.com/iotaledger/iota.go/guards"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// tenant ids end up in file paths, collection names and route prefixes
+var tenantID = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_-]{0,63}$`)
+
+// IsValidTenantID tells whether the given tenant id can safely be used as path segment, collection suffix and URL part.
+func IsValidTenantID(id string) bool {
+	return tenantID.MatchString(id)
+}
+
+// Report gathers the problems of a configuration.
+type Report struct {
+	Problems []string
+}
+
+// Addf adds a problem of the given field.
+func (r *Report) Addf(field string, format string, args ...interface{}) {
+	r.Problems = append(r.Problems, fmt.Sprintf("%s: %s", field, fmt.Sprintf(format, args...)))
+}
+
+// Err returns the report as error or nil if there are no problems.
+func (r *Report) Err() error {
+	if len(r.Problems) == 0 {
+		return nil
+	}
+	return r
+}
+
+func (r *Report) Error() string {
+	return fmt.Sprintf("invalid config, %d problem(s):\n  - %s", len(r.Problems), strings.Join(r.Problems, "\n  - "))
+}
+
+// Seed checks that the given seed consists of 81 trytes.
+func (r *Report) Seed(field string, seed string) {
+	if !guards.IsTrytesOfExactLength(seed, consts.HashTrytesSize) {
+		r.Addf(field, "must be 81 trytes (A-Z and 9), got %d characters", len(seed))
+	}
+}
+
+// File checks that the given file exists.
+func (r *Report) File(field string, path string) {
+	if _, err := os.Stat(path); err != nil {
+		r.Addf(field, "%s is not accessible: %s", path, err)
+	}
+}
+
+// SecurityLevel checks that the given security level is between 1 and 3.
+func (r *Report) SecurityLevel(field string, lvl uint64) {
+	if lvl < uint64(consts.SecurityLevelLow) || lvl > uint64(consts.SecurityLevelHigh) {
+		r.Addf(field, "must be between 1 and 3, got %d", lvl)
+	}
+}
+
+// NonZero checks that the given value is set.
+func (r *Report) NonZero(field string, v uint64) {
+	if v == 0 {
+		r.Addf(field, "must be greater than 0")
+	}
+}
+
+// NonEmpty checks that the given value is set.
+func (r *Report) NonEmpty(field string, v string) {
+	if strings.TrimSpace(v) == "" {
+		r.Addf(field, "must not be empty")
+	}
+}
+
+// URL checks that the given value is an absolute URL using one of the given schemes.
+func (r *Report) URL(field string, raw string, schemes ...string) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		r.Addf(field, "'%s' is not a valid URL", raw)
+		return
+	}
+	for _, scheme := range schemes {
+		if u.Scheme == scheme {
+			return
+		}
+	}
+	r.Addf(field, "'%s' must use one of the schemes %s", raw, strings.Join(schemes, ", "))
+}
+
+// MongoURI checks that the given value is a MongoDB connection string.
+func (r *Report) MongoURI(field string, uri string) {
+	r.URL(field, uri, "mongodb", "mongodb+srv")
+}
+
+// Quorum checks the nodes and thresholds of the given quorum.
+func (r *Report) Quorum(field string, q QuorumConfig) {
+	if len(q.Nodes) < 2 {
+		r.Addf(field+".nodes", "must contain at least two nodes, got %d", len(q.Nodes))
+	}
+	for i, node := range q.Nodes {
+		r.URL(fmt.Sprintf("%s.nodes[%d]", field, i), node, "http", "https")
+	}
+	if q.PrimaryNode == "" {
+		r.Addf(field+".primary_node", "must not be empty")
+	} else {
+		r.URL(field+".primary_node", q.PrimaryNode, "http", "https")
+	}
+	// 0 stands for the default threshold of the quorum client
+	if q.Threshold != 0 && (q.Threshold <= api.MinimumQuorumThreshold || q.Threshold > 1) {
+		r.Addf(field+".threshold", "must be 0 for the default or greater than %v and at most 1, got %v",
+			api.MinimumQuorumThreshold, q.Threshold)
+	}
+	if q.NoResponseTolerance < 0 || q.NoResponseTolerance > 1 {
+		r.Addf(field+".no_response_tolerance", "must be between 0 and 1, got %v", q.NoResponseTolerance)
+	}
+	r.NonZero(field+".timeout", q.Timeout)
+}
+
+// Validate checks the configuration and returns a *Report with all problems found or nil if there are none.
+func (c *Configuration) Validate() error {
+	r := &Report{}
+	c.App.validate(r)
+	return r.Err()
+}
+
+func (c *AppConfig) validate(r *Report) {
+	c.Account.validate(r, c.Dev)
+	r.NonEmpty("http.address", c.HTTP.Address)
+	c.HTTP.TLS.validate(r)
+	c.HTTP.Websocket.validate(r)
+	for i, token := range c.Admin.Tokens {
+		r.NonEmpty(fmt.Sprintf("admin.tokens[%d].name", i), token.Name)
+		r.NonEmpty(fmt.Sprintf("admin.tokens[%d].token", i), token.Token)
+	}
+}
+
+func (acc *AccountConfig) validate(r *Report, dev bool) {
+	switch {
+	case acc.Keystore.File != "":
+		r.File("account.keystore.file", acc.Keystore.File)
+		if acc.Keystore.PassphraseFile != "" {
+			r.File("account.keystore.passphrase_file", acc.Keystore.PassphraseFile)
+		}
+	case acc.Seed == "":
+		r.Addf("account.keystore.file", "either a keystore or, in dev mode, a seed must be configured")
+	case !dev:
+		r.Addf("account.seed", "plaintext seeds are only accepted in dev mode, use a keystore")
+	default:
+		r.Seed("account.seed", acc.Seed)
+	}
+
+	r.Quorum("account.quorum", acc.Quorum)
+	r.NonZero("account.mwm", acc.MWM)
+	r.NonZero("account.gtta_depth", acc.GTTADepth)
+	r.SecurityLevel("account.security_level", acc.SecurityLevel)
+	r.NonZero("account.transfer_poll_interval", acc.TransferPollInterval)
+	if acc.PromoteReattach {
+		r.NonZero("account.promote_reattach_interval", acc.PromoteReattachInterval)
+	}
+	r.NonZero("account.address_validity_timeout_days", acc.AddressValidityTimeoutDays)
+	r.NonEmpty("account.time.ntp_server", acc.Time.NTPServer)
+
+	switch acc.DonationMode {
+	case "", "shared", "per_visitor":
+	default:
+		r.Addf("account.donation_mode", "must be either 'shared' or 'per_visitor', got '%s'", acc.DonationMode)
+	}
+
+	switch acc.Store.Backend {
+	case "", "mongo":
+		r.MongoURI("account.mongodb.uri", acc.MongoDB.URI)
+		r.NonEmpty("account.mongodb.dbname", acc.MongoDB.DBName)
+		r.NonEmpty("account.mongodb.collname", acc.MongoDB.CollName)
+	case "badger":
+		r.NonEmpty("account.store.badger.dir", acc.Store.Badger.Dir)
+	case "memory":
+	default:
+		r.Addf("account.store.backend", "must be either 'mongo', 'badger' or 'memory', got '%s'", acc.Store.Backend)
+	}
+
+	ids := map[string]bool{}
+	for i, campaign := range acc.Campaigns {
+		field := fmt.Sprintf("account.campaigns[%d].id", i)
+		if campaign.ID == "" || ids[campaign.ID] {
+			r.Addf(field, "missing or duplicate campaign id '%s'", campaign.ID)
+		}
+		ids[campaign.ID] = true
+	}
+	ids = map[string]bool{}
+	for i, tenant := range acc.Tenants {
+		field := fmt.Sprintf("account.tenants[%d]", i)
+		switch {
+		case tenant.ID == "" || ids[tenant.ID]:
+			r.Addf(field+".id", "missing or duplicate tenant id '%s'", tenant.ID)
+		case !IsValidTenantID(tenant.ID):
+			r.Addf(field+".id", "'%s' must only consist of up to 64 letters, digits, '-' and '_'", tenant.ID)
+		}
+		ids[tenant.ID] = true
+		switch {
+		case tenant.Keystore != "":
+			r.File(field+".keystore", tenant.Keystore)
+		case tenant.Seed == "":
+			r.Addf(field+".keystore", "either a keystore or, in dev mode, a seed must be configured")
+		case !dev:
+			r.Addf(field+".seed", "plaintext seeds are only accepted in dev mode, use a keystore")
+		default:
+			r.Seed(field+".seed", tenant.Seed)
+		}
+	}
+
+	if acc.Sweep.Enabled && !guards.IsTrytesOfExactLength(acc.Sweep.Address, consts.AddressWithChecksumTrytesSize) {
+		r.Addf("account.sweep.address", "must be 90 trytes including the checksum")
+	}
+
+	switch acc.Price.Source {
+	case "", "static", "coingecko":
+	case "file":
+		r.File("account.price.file", acc.Price.File)
+	default:
+		r.Addf("account.price.source", "must be either 'static', 'file' or 'coingecko', got '%s'", acc.Price.Source)
+	}
+
+	if acc.Goal.Deadline != "" {
+		if _, err := time.Parse(time.RFC3339, acc.Goal.Deadline); err != nil {
+			r.Addf("account.goal.deadline", "must be an RFC3339 timestamp, got '%s'", acc.Goal.Deadline)
+		}
+	}
+
+	ids = map[string]bool{}
+	for i, endpoint := range acc.Webhooks.Endpoints {
+		field := fmt.Sprintf("account.webhooks.endpoints[%d]", i)
+		if endpoint.ID == "" || ids[endpoint.ID] {
+			r.Addf(field+".id", "missing or duplicate endpoint id '%s'", endpoint.ID)
+		}
+		ids[endpoint.ID] = true
+		r.URL(field+".url", endpoint.URL, "http", "https")
+	}
+}
+
+func (c *TLSConfig) validate(r *Report) {
+	if !c.Enabled() {
+		if c.KeyFile != "" {
+			r.Addf("http.tls.cert_file", "must be set if a key is configured")
+		}
+		if c.RedirectAddress != "" {
+			r.Addf("http.tls.redirect_address", "requires TLS to be enabled")
+		}
+		return
+	}
+	r.File("http.tls.cert_file", c.CertFile)
+	r.NonEmpty("http.tls.key_file", c.KeyFile)
+	if c.KeyFile != "" {
+		r.File("http.tls.key_file", c.KeyFile)
+	}
+	if _, err := c.Version(); err != nil {
+		r.Addf("http.tls.min_version", "must be either '1.0', '1.1', '1.2' or '1.3', got '%s'", c.MinVersion)
+	}
+	if c.HSTSMaxAge < 0 {
+		r.Addf("http.tls.hsts_max_age", "must not be negative")
+	}
+}
+
+func (c *WebsocketConfig) validate(r *Report) {
+	if c.MaxClients < 0 {
+		r.Addf("http.websocket.max_clients", "must not be negative")
+	}
+	if c.SendQueueSize < 0 {
+		r.Addf("http.websocket.send_queue_size", "must not be negative")
+	}
+	switch c.SlowClientPolicy {
+	case "", SlowClientDrop, SlowClientDisconnect:
+	default:
+		r.Addf("http.websocket.slow_client_policy", "must be either '%s' or '%s', got '%s'",
+			SlowClientDisconnect, SlowClientDrop, c.SlowClientPolicy)
+	}
+}
@@ -0,0 +1,183 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+var testSeed = strings.Repeat("SEED", 20) + "9"
+
+// validConfig returns a configuration of a dev server which passes the validation.
+func validConfig() *Configuration {
+	c := &Configuration{}
+	c.App.Dev = true
+	c.App.HTTP.Address = "127.0.0.1:9000"
+	acc := &c.App.Account
+	acc.Seed = testSeed
+	acc.Quorum = QuorumConfig{
+		PrimaryNode: "https://a.example.org:14265",
+		Nodes:       []string{"https://a.example.org:14265", "https://b.example.org:14265"},
+		Threshold:   0.66, Timeout: 10,
+	}
+	acc.MWM = 14
+	acc.GTTADepth = 3
+	acc.SecurityLevel = 2
+	acc.TransferPollInterval = 10
+	acc.AddressValidityTimeoutDays = 3
+	acc.Time.NTPServer = "time.google.com"
+	acc.Store.Backend = "memory"
+	return c
+}
+
+// problemFields returns the fields named in the problems of the given error.
+func problemFields(t *testing.T, err error) []string {
+	if err == nil {
+		return nil
+	}
+	r, ok := err.(*Report)
+	if !ok {
+		t.Fatalf("expected a *Report, got %T", err)
+	}
+	fields := make([]string, len(r.Problems))
+	for i, problem := range r.Problems {
+		fields[i] = strings.SplitN(problem, ":", 2)[0]
+	}
+	return fields
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c *Configuration)
+		fields []string
+	}{
+		{name: "valid", modify: func(c *Configuration) {}},
+		{name: "default threshold", modify: func(c *Configuration) { c.App.Account.Quorum.Threshold = 0 }},
+		{name: "full threshold", modify: func(c *Configuration) { c.App.Account.Quorum.Threshold = 1 }},
+		{
+			name:   "threshold of the minimum",
+			modify: func(c *Configuration) { c.App.Account.Quorum.Threshold = 0.5 },
+			fields: []string{"account.quorum.threshold"},
+		},
+		{
+			name:   "threshold above 1",
+			modify: func(c *Configuration) { c.App.Account.Quorum.Threshold = 1.5 },
+			fields: []string{"account.quorum.threshold"},
+		},
+		{
+			name:   "single node",
+			modify: func(c *Configuration) { c.App.Account.Quorum.Nodes = c.App.Account.Quorum.Nodes[:1] },
+			fields: []string{"account.quorum.nodes"},
+		},
+		{
+			name:   "invalid node",
+			modify: func(c *Configuration) { c.App.Account.Quorum.Nodes[1] = "b.example.org:14265" },
+			fields: []string{"account.quorum.nodes[1]"},
+		},
+		{
+			name:   "seed outside dev mode",
+			modify: func(c *Configuration) { c.App.Dev = false },
+			fields: []string{"account.seed"},
+		},
+		{
+			name:   "invalid seed",
+			modify: func(c *Configuration) { c.App.Account.Seed = "SEED" },
+			fields: []string{"account.seed"},
+		},
+		{
+			name:   "no seed",
+			modify: func(c *Configuration) { c.App.Account.Seed = "" },
+			fields: []string{"account.keystore.file"},
+		},
+		{
+			name:   "missing keystore",
+			modify: func(c *Configuration) { c.App.Account.Keystore.File = "/nonexistent/seed.json" },
+			fields: []string{"account.keystore.file"},
+		},
+		{
+			name: "mongo store",
+			modify: func(c *Configuration) {
+				c.App.Account.Store.Backend = "mongo"
+				c.App.Account.MongoDB.URI = "http://localhost:27017"
+			},
+			fields: []string{"account.mongodb.uri", "account.mongodb.dbname", "account.mongodb.collname"},
+		},
+		{
+			name: "duplicate campaigns",
+			modify: func(c *Configuration) {
+				c.App.Account.Campaigns = []CampaignConfig{{ID: "article"}, {ID: "article"}}
+			},
+			fields: []string{"account.campaigns[1].id"},
+		},
+		{
+			name: "valid tenant",
+			modify: func(c *Configuration) {
+				c.App.Account.Tenants = []TenantConfig{{ID: "tenant_1", Seed: testSeed}}
+			},
+		},
+		{
+			name: "tenant id with path",
+			modify: func(c *Configuration) {
+				c.App.Account.Tenants = []TenantConfig{{ID: "../tenant", Seed: testSeed}}
+			},
+			fields: []string{"account.tenants[0].id"},
+		},
+		{
+			name: "all problems at once",
+			modify: func(c *Configuration) {
+				c.App.Account.MWM = 0
+				c.App.Account.SecurityLevel = 4
+				c.App.Account.DonationMode = "everyone"
+				c.App.HTTP.Address = ""
+			},
+			fields: []string{"account.mwm", "account.security_level", "account.donation_mode", "http.address"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := validConfig()
+			test.modify(c)
+			fields := problemFields(t, c.Validate())
+			if strings.Join(fields, ",") != strings.Join(test.fields, ",") {
+				t.Fatalf("expected problems with %v, got %v", test.fields, fields)
+			}
+		})
+	}
+}
+
+func TestReport(t *testing.T) {
+	r := &Report{}
+	if r.Err() != nil {
+		t.Fatal("expected no error without problems")
+	}
+
+	r.NonZero("a", 1)
+	r.NonEmpty("b", "value")
+	r.SecurityLevel("c", 3)
+	r.Seed("d", testSeed)
+	r.URL("e", "https://example.org", "http", "https")
+	r.MongoURI("f", "mongodb://localhost:27017")
+	if err := r.Err(); err != nil {
+		t.Fatalf("expected no problems, got %v", err)
+	}
+
+	r.NonZero("a", 0)
+	r.NonEmpty("b", "  ")
+	r.SecurityLevel("c", 0)
+	r.Seed("d", "SEED")
+	r.URL("e", "ftp://example.org", "http", "https")
+	r.MongoURI("f", "localhost:27017")
+	r.File("g", "/nonexistent/file")
+	r.Addf("h", "custom problem %d", 1)
+	err := r.Err()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	expected := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	if fields := problemFields(t, err); strings.Join(fields, ",") != strings.Join(expected, ",") {
+		t.Fatalf("expected problems with %v, got %v", expected, fields)
+	}
+	if msg := err.Error(); !strings.HasPrefix(msg, "invalid config, 8 problem(s):") || !strings.Contains(msg, "h: custom problem 1") {
+		t.Fatalf("unexpected error message: %s", msg)
+	}
+}
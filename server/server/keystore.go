@@ -0,0 +1,59 @@
+package server
+
+import (
+	"fmt"
+	"github.com/luca-moser/donapoc/server/keystore"
+	"github.com/luca-moser/donapoc/server/server/config"
+	"github.com/luca-moser/donapoc/server/utilities"
+	"github.com/pkg/errors"
+	"os"
+)
+
+// ConvertSeed encrypts the plaintext seed of the main account or of the tenant with the given id
+// into a new keystore file at the given path.
+func ConvertSeed(opts config.Options, path string, tenantID string) error {
+	conf, err := loadConfig(opts)
+	if err != nil {
+		return err
+	}
+	accConf := conf.App.Account
+	seed, key := accConf.Seed, "account.seed"
+	if tenantID != "" {
+		seed, key = "", ""
+		for _, tenantConf := range accConf.Tenants {
+			if tenantConf.ID == tenantID {
+				seed, key = tenantConf.Seed, fmt.Sprintf("seed of tenant '%s'", tenantID)
+			}
+		}
+		if key == "" {
+			return fmt.Errorf("tenant '%s' isn't configured", tenantID)
+		}
+	}
+	if seed == "" {
+		return fmt.Errorf("%s isn't set, there is nothing to convert", key)
+	}
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s already exists", path)
+	}
+
+	passphrase, err := keystore.NewPassphrase(accConf.Keystore.PassphraseFile)
+	if err != nil {
+		return err
+	}
+	ks, err := keystore.Encrypt(seed, passphrase)
+	if err != nil {
+		return err
+	}
+	if err := keystore.WriteFile(path, ks); err != nil {
+		return errors.Wrapf(err, "unable to write keystore %s", path)
+	}
+
+	logger, _ := utilities.GetLogger("app")
+	logger.Info("wrote keystore", "file", path)
+	if tenantID != "" {
+		logger.Info(fmt.Sprintf("set the tenant's keystore to %s and remove its seed from the config", path))
+		return nil
+	}
+	logger.Info(fmt.Sprintf("set account.keystore.file to %s and remove account.seed from the config", path))
+	return nil
+}
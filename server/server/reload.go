@@ -0,0 +1,80 @@
+package server
+
+import (
+	"fmt"
+	"github.com/luca-moser/donapoc/server/controllers"
+	"github.com/luca-moser/donapoc/server/server/config"
+	"github.com/luca-moser/donapoc/server/utilities"
+	"github.com/pkg/errors"
+	"regexp"
+	"strings"
+)
+
+// the settings which are applied without a restart, slice indices are stripped from the paths
+var reloadable = []string{
+	"verbose",
+	"account.quorum",
+	"account.transfer_poll_interval",
+	"account.promote_reattach_interval",
+	"account.address_validity_timeout_days",
+	"account.campaigns[].address_validity_timeout_days",
+}
+
+var sliceIndex = regexp.MustCompile(`\[\d+\]`)
+
+func isReloadable(path string) bool {
+	path = sliceIndex.ReplaceAllString(path, "[]")
+	for _, setting := range reloadable {
+		if path == setting || strings.HasPrefix(path, setting+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Reload reads the config again and applies the settings which can change while the server is running:
+// the quorum, the poll and promote intervals, the validity of new deposit addresses and the log verbosity.
+// Other changes are only reported as they take effect after a restart. A setting which fails to apply
+// doesn't keep the others from being applied, the failures are returned together.
+func (server *Server) Reload() error {
+	conf, err := config.LoadConfig(server.Options)
+	if err != nil {
+		return err
+	}
+	if err := conf.Validate(); err != nil {
+		return err
+	}
+
+	var applied, restart []string
+	for _, change := range config.Diff(server.Config, conf) {
+		if isReloadable(change) {
+			applied = append(applied, change)
+			continue
+		}
+		restart = append(restart, change)
+	}
+	if len(restart) > 0 {
+		server.logger.Warn("config changes require a restart", "changes", strings.Join(restart, ", "))
+	}
+	if len(applied) == 0 {
+		server.logger.Info("reloaded config, nothing to apply")
+		return nil
+	}
+
+	utilities.SetDebug(conf.App.Verbose)
+	server.Config.App.Verbose = conf.App.Verbose
+	var failed []string
+	for _, ctrl := range server.ctrls {
+		if r, ok := ctrl.(controllers.Reloader); ok {
+			if err := r.Reload(conf); err != nil {
+				server.logger.Error("unable to reload controller", "ctrl", fmt.Sprintf("%T", ctrl), "err", err)
+				failed = append(failed, fmt.Sprintf("%T: %s", ctrl, err))
+			}
+		}
+	}
+	if len(failed) > 0 {
+		return errors.Errorf("reloaded config partially, %d controller(s) failed: %s", len(failed), strings.Join(failed, "; "))
+	}
+	server.logger.Info("reloaded config", "applied", strings.Join(applied, ", "))
+	return nil
+}
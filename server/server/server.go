@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"github.com/facebookgo/inject"
 	"github.com/labstack/echo"
@@ -9,9 +10,13 @@ import (
 	"github.com/luca-moser/donapoc/server/routers"
 	"github.com/luca-moser/donapoc/server/server/config"
 	"github.com/luca-moser/donapoc/server/utilities"
+	"github.com/pkg/errors"
+	"gopkg.in/inconshreveable/log15.v2"
 	"html/template"
 	"io"
+	"net/http"
 	"os"
+	"path/filepath"
 	"time"
 )
 
@@ -24,25 +29,40 @@ func (t *TemplateRendered) Render(w io.Writer, name string, data interface{}, c
 }
 
 type Server struct {
+	// where the config is loaded from
+	Options   config.Options
 	Config    *config.Configuration
 	WebEngine *echo.Echo
+	// redirects HTTP to HTTPS if TLS is enabled
+	redirectServer *http.Server
+	logger         log15.Logger
+	ctrls          []controllers.Controller
+	rters          []routers.Router
 }
 
-func (server *Server) Start() {
+// Start loads the config, initialises the controllers and routers and starts the web server.
+func (server *Server) Start() error {
 	start := time.Now().UnixNano()
 
 	// load config
-	configuration := config.LoadConfig()
+	configuration, err := loadConfig(server.Options)
+	if err != nil {
+		return err
+	}
+	if err := configuration.Validate(); err != nil {
+		return err
+	}
 	server.Config = configuration
 	appConfig := server.Config.App
 	httpConfig := server.Config.App.HTTP
 
 	// init logger
-	utilities.Debug = appConfig.Verbose
+	utilities.SetDebug(appConfig.Verbose)
 	logger, err := utilities.GetLogger("app")
 	if err != nil {
-		panic(err)
+		return errors.Wrap(err, "unable to initialise logger")
 	}
+	server.logger = logger
 	logger.Info("booting up app...")
 
 	// init web server
@@ -50,18 +70,28 @@ func (server *Server) Start() {
 	e.HideBanner = true
 	server.WebEngine = e
 	if httpConfig.LogRequests {
-		requestLogFile, err := os.Create(fmt.Sprintf("./logs/requests.log"))
+		requestLogFile, err := os.Create(filepath.Join(utilities.LogDir, "requests.log"))
 		if err != nil {
-			panic(err)
+			return errors.Wrap(err, "unable to create request log")
 		}
 		e.Use(middleware.LoggerWithConfig(middleware.LoggerConfig{Output: requestLogFile}))
 		e.Logger.SetLevel(3)
 	}
 
+	// tell browsers to only use HTTPS, also applies if TLS is terminated by a proxy setting X-Forwarded-Proto
+	if httpConfig.TLS.HSTSMaxAge > 0 {
+		e.Use(middleware.SecureWithConfig(middleware.SecureConfig{
+			HSTSMaxAge:            httpConfig.TLS.HSTSMaxAge,
+			HSTSExcludeSubdomains: !httpConfig.TLS.HSTSIncludeSubdomains,
+		}))
+	}
+
 	// load html files
-	e.Renderer = &TemplateRendered{
-		templates: template.Must(template.ParseGlob(fmt.Sprintf("%s/*.html", httpConfig.Assets.HTML))),
+	templates, err := template.ParseGlob(fmt.Sprintf("%s/*.html", httpConfig.Assets.HTML))
+	if err != nil {
+		return errors.Wrap(err, "unable to load html templates")
 	}
+	e.Renderer = &TemplateRendered{templates: templates}
 
 	// asset paths
 	e.Static("/assets", httpConfig.Assets.Static)
@@ -70,12 +100,32 @@ func (server *Server) Start() {
 	// create ctrls
 	appCtrl := &controllers.AppCtrl{}
 	accCtrl := &controllers.AccCtrl{}
-	ctrls := []controllers.Controller{appCtrl, accCtrl}
+	priceCtrl := &controllers.PriceCtrl{}
+	ledgerCtrl := &controllers.LedgerCtrl{}
+	goalCtrl := &controllers.GoalCtrl{}
+	sweepCtrl := &controllers.SweepCtrl{}
+	webhookCtrl := &controllers.WebhookCtrl{}
+	tenantCtrl := &controllers.TenantCtrl{}
+	metricsCtrl := &controllers.MetricsCtrl{}
+	healthCtrl := &controllers.HealthCtrl{}
+	adminCtrl := &controllers.AdminCtrl{}
+	ctrls := []controllers.Controller{appCtrl, priceCtrl, accCtrl, ledgerCtrl, goalCtrl, sweepCtrl, webhookCtrl, tenantCtrl, metricsCtrl, healthCtrl, adminCtrl}
 
 	// create routers
 	indexRouter := &routers.IndexRouter{}
 	accRouter := &routers.AccRouter{}
-	rters := []routers.Router{indexRouter, accRouter}
+	ledgerRouter := &routers.LedgerRouter{}
+	campaignRouter := &routers.CampaignRouter{}
+	goalRouter := &routers.GoalRouter{}
+	sweepRouter := &routers.SweepRouter{}
+	webhookRouter := &routers.WebhookRouter{}
+	tenantRouter := &routers.TenantRouter{}
+	metricsRouter := &routers.MetricsRouter{}
+	healthRouter := &routers.HealthRouter{}
+	adminRouter := &routers.AdminRouter{}
+	rters := []routers.Router{indexRouter, accRouter, ledgerRouter, campaignRouter, goalRouter, sweepRouter, webhookRouter, tenantRouter, metricsRouter, healthRouter, adminRouter}
+	server.ctrls = ctrls
+	server.rters = rters
 
 	// create injection graph for automatic dependency injection
 	g := inject.Graph{}
@@ -86,32 +136,32 @@ func (server *Server) Start() {
 		&inject.Object{Value: configuration},
 		&inject.Object{Value: appConfig.Dev, Name: "dev"},
 	); err != nil {
-		panic(err)
+		return err
 	}
 
 	// add ctrls to graph
 	for _, controller := range ctrls {
 		if err = g.Provide(&inject.Object{Value: controller}); err != nil {
-			panic(err)
+			return err
 		}
 	}
 
 	// add routers to graph
 	for _, router := range rters {
 		if err = g.Provide(&inject.Object{Value: router}); err != nil {
-			panic(err)
+			return err
 		}
 	}
 
 	// run dependency injection
 	if err = g.Populate(); err != nil {
-		panic(err)
+		return errors.Wrap(err, "unable to inject dependencies")
 	}
 
 	// init ctrls
 	for _, controller := range ctrls {
 		if err = controller.Init(); err != nil {
-			panic(err)
+			return errors.Wrapf(err, "unable to initialise %T", controller)
 		}
 	}
 	logger.Info("initialised controllers")
@@ -123,15 +173,62 @@ func (server *Server) Start() {
 	logger.Info("initialised routers")
 
 	// boot up server
-	go e.Start(httpConfig.Address)
+	if httpConfig.TLS.Enabled() {
+		if err := server.startTLS(httpConfig); err != nil {
+			return err
+		}
+	} else {
+		go func() {
+			if err := e.Start(httpConfig.Address); err != nil && err != http.ErrServerClosed {
+				logger.Error("web server stopped", "err", err)
+			}
+		}()
+	}
 
 	// finish
 	delta := (time.Now().UnixNano() - start) / 1000000
 	logger.Info("app ready", "startup", delta)
+	return nil
 }
 
-func (server *Server) Shutdown(timeout time.Duration) {
-	select {
-	case <-time.After(timeout):
+// Shutdown gracefully shuts down the server within the given timeout:
+// the web server stops accepting requests, then routers and afterwards controllers
+// are shut down in reverse order of their initialisation.
+func (server *Server) Shutdown(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	server.logger.Info("shutting down app...", "timeout", timeout)
+
+	var firstErr error
+	keepErr := func(err error) {
+		if err == nil {
+			return
+		}
+		server.logger.Error("error during shutdown", "err", err)
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if server.redirectServer != nil {
+		keepErr(server.redirectServer.Shutdown(ctx))
+	}
+	if server.WebEngine != nil {
+		keepErr(server.WebEngine.Shutdown(ctx))
+	}
+	for i := len(server.rters) - 1; i >= 0; i-- {
+		if s, ok := server.rters[i].(controllers.Shutdowner); ok {
+			keepErr(s.Shutdown(ctx))
+		}
+	}
+	for i := len(server.ctrls) - 1; i >= 0; i-- {
+		if s, ok := server.ctrls[i].(controllers.Shutdowner); ok {
+			keepErr(s.Shutdown(ctx))
+		}
+	}
+
+	if firstErr == nil {
+		server.logger.Info("bye!")
 	}
+	return firstErr
 }
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"github.com/luca-moser/donapoc/server/controllers"
+	"github.com/luca-moser/donapoc/server/server/config"
+	"github.com/luca-moser/donapoc/server/statefile"
+	"github.com/luca-moser/donapoc/server/utilities"
+	"github.com/pkg/errors"
+)
+
+// ExportState writes the state of the main account to the file at the given path.
+// The server must not be running.
+func ExportState(opts config.Options, path string) error {
+	conf, err := loadConfig(opts)
+	if err != nil {
+		return err
+	}
+	accCtrl := &controllers.AccCtrl{Config: conf}
+	accountID, err := accCtrl.OpenStores()
+	if err != nil {
+		return err
+	}
+	defer accCtrl.CloseStores()
+
+	state, err := statefile.Export(accCtrl.Store(), accountID)
+	if err != nil {
+		return err
+	}
+	if err := statefile.WriteFile(path, state); err != nil {
+		return errors.Wrapf(err, "unable to write state file %s", path)
+	}
+	logger, _ := utilities.GetLogger("app")
+	logger.Info("exported account state", "file", path, "state", state.Summary())
+	return nil
+}
+
+// ImportState imports the state file at the given path into the store of the main account,
+// overriding its existing state. The server must not be running.
+func ImportState(opts config.Options, path string, force bool) error {
+	conf, err := loadConfig(opts)
+	if err != nil {
+		return err
+	}
+	state, err := statefile.ReadFile(path)
+	if err != nil {
+		return errors.Wrapf(err, "unable to read state file %s", path)
+	}
+	accCtrl := &controllers.AccCtrl{Config: conf}
+	accountID, err := accCtrl.OpenStores()
+	if err != nil {
+		return err
+	}
+	defer accCtrl.CloseStores()
+
+	if err := statefile.Import(accCtrl.Store(), state, accountID, force); err != nil {
+		return err
+	}
+	logger, _ := utilities.GetLogger("app")
+	logger.Info("imported account state", "file", path, "state", state.Summary())
+	return nil
+}
+
+// loadConfig loads the config for the maintenance commands.
+func loadConfig(opts config.Options) (*config.Configuration, error) {
+	conf, err := config.LoadConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	utilities.LogDir = conf.App.DataPath("./logs")
+	return conf, nil
+}
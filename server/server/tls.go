@@ -0,0 +1,68 @@
+package server
+
+import (
+	"crypto/tls"
+	"github.com/luca-moser/donapoc/server/server/config"
+	"github.com/pkg/errors"
+	"net"
+	"net/http"
+)
+
+// startTLS starts the web server over HTTPS and, if configured, the HTTP listener redirecting to it.
+func (server *Server) startTLS(httpConfig config.WebConfig) error {
+	tlsConfig := httpConfig.TLS
+	minVersion, err := tlsConfig.Version()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(tlsConfig.CertFile, tlsConfig.KeyFile)
+	if err != nil {
+		return errors.Wrap(err, "unable to load TLS certificate")
+	}
+
+	e := server.WebEngine
+	s := e.TLSServer
+	s.Addr = httpConfig.Address
+	s.TLSConfig = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   minVersion,
+		// websocket connections are made over HTTP/1.1
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+	go func() {
+		if err := e.StartServer(s); err != nil && err != http.ErrServerClosed {
+			server.logger.Error("web server stopped", "err", err)
+		}
+	}()
+
+	if tlsConfig.RedirectAddress == "" {
+		return nil
+	}
+	server.redirectServer = &http.Server{Addr: tlsConfig.RedirectAddress, Handler: redirectToHTTPS(httpConfig)}
+	go func() {
+		if err := server.redirectServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			server.logger.Error("HTTP redirect server stopped", "err", err)
+		}
+	}()
+	server.logger.Info("redirecting HTTP to HTTPS", "address", tlsConfig.RedirectAddress)
+	return nil
+}
+
+// redirectToHTTPS returns a handler which permanently redirects requests to the configured domain
+// or, if none is set, to the requested host on the port of the HTTPS listener.
+func redirectToHTTPS(httpConfig config.WebConfig) http.Handler {
+	_, port, _ := net.SplitHostPort(httpConfig.Address)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := httpConfig.Domain
+		if host == "" {
+			host = r.Host
+			if h, _, err := net.SplitHostPort(r.Host); err == nil {
+				host = h
+			}
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
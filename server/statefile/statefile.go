@@ -0,0 +1,159 @@
+// Package statefile exports and imports the state of an account to and from a versioned JSON file.
+package statefile
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/iotaledger/iota.go/account/store"
+	"github.com/iotaledger/iota.go/consts"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"time"
+)
+
+// Version is the version of the file format written by this package.
+const Version = 1
+
+var ErrUnsupportedVersion = errors.New("unsupported state file version")
+var ErrAccountMismatch = errors.New("state file belongs to another account")
+var ErrInvalidState = errors.New("invalid account state")
+
+// State is the exported state of an account.
+type State struct {
+	Version    int       `json:"version"`
+	AccountID  string    `json:"account_id"`
+	ExportedAt time.Time `json:"exported_at"`
+	// the last used key index
+	KeyIndex uint64 `json:"key_index"`
+	// the deposit requests which are still watched by the account by key index
+	DepositRequests map[uint64]*store.StoredDepositAddress `json:"deposit_requests"`
+	// the outgoing transfers which aren't confirmed yet by their origin tail transaction hash
+	PendingTransfers map[string]*store.PendingTransfer `json:"pending_transfers"`
+}
+
+// Export exports the state of the given account from the given store.
+func Export(s store.Store, accountID string) (*State, error) {
+	exported, err := s.ExportAccount(accountID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to export account %s", accountID)
+	}
+	state := &State{
+		Version: Version, AccountID: accountID, ExportedAt: time.Now().UTC(), KeyIndex: exported.KeyIndex,
+		DepositRequests: exported.DepositAddresses, PendingTransfers: exported.PendingTransfers,
+	}
+	if state.DepositRequests == nil {
+		state.DepositRequests = map[uint64]*store.StoredDepositAddress{}
+	}
+	if state.PendingTransfers == nil {
+		state.PendingTransfers = map[string]*store.PendingTransfer{}
+	}
+	return state, nil
+}
+
+// Import imports the given state into the given store, overriding the existing state of the account.
+// The state is refused if it is invalid or was exported from another account unless force is set.
+func Import(s store.Store, state *State, accountID string, force bool) error {
+	if err := state.Check(accountID, force); err != nil {
+		return err
+	}
+	return s.ImportAccount(store.ExportedAccountState{
+		ID: accountID, Date: state.ExportedAt,
+		AccountState: store.AccountState{
+			KeyIndex: state.KeyIndex, DepositAddresses: state.DepositRequests, PendingTransfers: state.PendingTransfers,
+		},
+	})
+}
+
+// Write writes the given state as indented JSON.
+func Write(w io.Writer, state *State) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(state)
+}
+
+// Read reads a state written by Write.
+func Read(r io.Reader) (*State, error) {
+	state := &State{}
+	if err := json.NewDecoder(r).Decode(state); err != nil {
+		return nil, errors.Wrap(err, "unable to decode state file")
+	}
+	if state.DepositRequests == nil {
+		state.DepositRequests = map[uint64]*store.StoredDepositAddress{}
+	}
+	if state.PendingTransfers == nil {
+		state.PendingTransfers = map[string]*store.PendingTransfer{}
+	}
+	if err := state.Validate(); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// WriteFile writes the given state to the file at the given path.
+func WriteFile(path string, state *State) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if err := Write(f, state); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadFile reads the state from the file at the given path.
+func ReadFile(path string) (*State, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f)
+}
+
+// Check checks whether the state can be imported into the given account.
+// The state is refused if it is invalid or was exported from another account unless force is set.
+func (state *State) Check(accountID string, force bool) error {
+	if state.AccountID != accountID && !force {
+		return errors.Wrapf(ErrAccountMismatch, "exported from %s, importing into %s", state.AccountID, accountID)
+	}
+	return state.Validate()
+}
+
+// Validate checks that the deposit requests and the pending transfers of the state are complete
+// and consistent with its key index.
+func (state *State) Validate() error {
+	if state.Version != Version {
+		return errors.Wrapf(ErrUnsupportedVersion, "version %d, expected %d", state.Version, Version)
+	}
+	if state.AccountID == "" {
+		return errors.Wrap(ErrInvalidState, "no account id")
+	}
+	for keyIndex, req := range state.DepositRequests {
+		switch {
+		case req == nil:
+			return errors.Wrapf(ErrInvalidState, "deposit request %d is empty", keyIndex)
+		case keyIndex > state.KeyIndex:
+			return errors.Wrapf(ErrInvalidState, "deposit request %d is above the key index %d", keyIndex, state.KeyIndex)
+		case req.SecurityLevel < consts.SecurityLevelLow || req.SecurityLevel > consts.SecurityLevelHigh:
+			return errors.Wrapf(ErrInvalidState, "deposit request %d has the invalid security level %d", keyIndex, req.SecurityLevel)
+		}
+	}
+	for originTail, transfer := range state.PendingTransfers {
+		if transfer == nil || len(transfer.Tails) == 0 {
+			return errors.Wrapf(ErrInvalidState, "pending transfer %s has no tails", originTail)
+		}
+		if _, err := store.PendingTransferToBundle(transfer); err != nil {
+			return errors.Wrapf(ErrInvalidState, "pending transfer %s has an invalid bundle: %s", originTail, err)
+		}
+	}
+	return nil
+}
+
+// Summary returns a short description of the state.
+func (state *State) Summary() string {
+	return fmt.Sprintf("account %s, key index %d, %d deposit requests, %d pending transfers",
+		state.AccountID, state.KeyIndex, len(state.DepositRequests), len(state.PendingTransfers))
+}
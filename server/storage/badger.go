@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"github.com/dgraph-io/badger"
+	"strings"
+)
+
+// NewBadgerKV opens (or creates) a badger database in the given directory.
+func NewBadgerKV(dir string) (*BadgerKV, error) {
+	opts := badger.DefaultOptions
+	opts.SyncWrites = true
+	opts.Dir = dir
+	opts.ValueDir = dir
+	db, err := badger.Open(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &BadgerKV{db: db}, nil
+}
+
+// BadgerKV is a KV backed by badger. Buckets are realized as key prefixes.
+type BadgerKV struct {
+	db *badger.DB
+}
+
+func bucketKey(bucket string, key string) []byte {
+	return []byte(bucket + "/" + key)
+}
+
+func (b *BadgerKV) Put(bucket string, key string, value []byte) error {
+	return b.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(bucketKey(bucket, key), value)
+	})
+}
+
+func (b *BadgerKV) Get(bucket string, key string) ([]byte, error) {
+	var value []byte
+	err := b.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(bucketKey(bucket, key))
+		if err != nil {
+			return err
+		}
+		value, err = item.ValueCopy(nil)
+		return err
+	})
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	}
+	return value, err
+}
+
+func (b *BadgerKV) Delete(bucket string, key string) error {
+	return b.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(bucketKey(bucket, key))
+	})
+}
+
+func (b *BadgerKV) ForEach(bucket string, f func(key string, value []byte) error) error {
+	return b.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		prefix := bucketKey(bucket, "")
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			item := it.Item()
+			value, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			if err := f(strings.TrimPrefix(string(item.Key()), string(prefix)), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b *BadgerKV) Close() error {
+	return b.db.Close()
+}
@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"github.com/iotaledger/iota.go/account/deposit"
+	"github.com/iotaledger/iota.go/consts"
+	"time"
+)
+
+// CDA is a conditional deposit address which was handed out by the server.
+type CDA struct {
+	// the address without checksum
+	ID             string     `json:"id" bson:"_id"`
+	AccountID      string     `json:"account_id" bson:"account_id"`
+	Address        string     `json:"address" bson:"address"`
+	TimeoutAt      *time.Time `json:"timeout_at" bson:"timeout_at"`
+	MultiUse       bool       `json:"multi_use" bson:"multi_use"`
+	ExpectedAmount *uint64    `json:"expected_amount,omitempty" bson:"expected_amount,omitempty"`
+	// whether this is the current shared deposit address of the account
+	Current bool `json:"current" bson:"current"`
+	// whether this is the pre-allocated next shared deposit address of the account
+	Next bool `json:"next,omitempty" bson:"next,omitempty"`
+	// the campaign the address belongs to, empty for the default campaign
+	Campaign string `json:"campaign,omitempty" bson:"campaign,omitempty"`
+	// the visitor session to which the address was handed out
+	Session   string    `json:"session,omitempty" bson:"session,omitempty"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
+
+// NewCDA creates a new record of the given deposit address for the given account.
+func NewCDA(accountID string, cda *deposit.CDA) *CDA {
+	return &CDA{
+		ID:             cda.Address[:consts.HashTrytesSize],
+		AccountID:      accountID,
+		Address:        cda.Address,
+		TimeoutAt:      cda.TimeoutAt,
+		MultiUse:       cda.MultiUse,
+		ExpectedAmount: cda.ExpectedAmount,
+		CreatedAt:      time.Now(),
+	}
+}
+
+// AsCDA converts the record back to a deposit address.
+func (rec *CDA) AsCDA() *deposit.CDA {
+	return &deposit.CDA{
+		Address: rec.Address,
+		Conditions: deposit.Conditions{
+			TimeoutAt: rec.TimeoutAt, MultiUse: rec.MultiUse, ExpectedAmount: rec.ExpectedAmount,
+		},
+	}
+}
+
+// CDAStore persists the deposit addresses handed out by the server.
+type CDAStore interface {
+	// AddCDA stores the given deposit address.
+	AddCDA(rec *CDA) error
+	// SetCurrentCDA stores the given deposit address as the current shared one of its account and campaign.
+	// The previously current deposit address is kept as a past one.
+	SetCurrentCDA(rec *CDA) error
+	// CurrentCDA returns the current shared deposit address of the given account and campaign or nil if there is none.
+	CurrentCDA(accountID string, campaign string) (*CDA, error)
+	// CDAs returns all deposit addresses (current and past) of the given account.
+	CDAs(accountID string) ([]*CDA, error)
+	// CDA returns the deposit address with the given id (the address without checksum) or nil if there is none.
+	CDA(id string) (*CDA, error)
+}
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"time"
+)
+
+// Donation is a deposit received by the account. Messages sent to a deposit address without
+// transferring any value are recorded as donations without value.
+type Donation struct {
+	// the bundle hash of the deposit
+	ID         string `json:"id" bson:"_id"`
+	AccountID  string `json:"account_id" bson:"account_id"`
+	BundleHash string `json:"bundle_hash" bson:"bundle_hash"`
+	// the tail transaction hash, set to the confirmed tail once the deposit is received
+	Tail string `json:"tail" bson:"tail"`
+	// the sum of all values deposited to the account's addresses within the bundle
+	Value   uint64 `json:"value" bson:"value"`
+	Address string `json:"address" bson:"address"`
+	// the deposit address the donation was made to
+	CDA *DonationCDA `json:"cda,omitempty" bson:"cda,omitempty"`
+	// the campaign the donation is attributed to, empty for the default campaign
+	Campaign string `json:"campaign,omitempty" bson:"campaign,omitempty"`
+	// when the deposit was first seen
+	ReceivingAt time.Time `json:"receiving_at" bson:"receiving_at"`
+	// when the deposit got confirmed
+	ReceivedAt *time.Time `json:"received_at,omitempty" bson:"received_at,omitempty"`
+	// the message and tag attached by the donor
+	Message string `json:"message" bson:"message"`
+	Tag     string `json:"tag" bson:"tag"`
+}
+
+// DonationCDA are the conditions of the deposit address a donation was made to. In contrast to the
+// full record of the address, it doesn't contain the visitor session as donations are public.
+type DonationCDA struct {
+	Address        string     `json:"address" bson:"address"`
+	TimeoutAt      *time.Time `json:"timeout_at" bson:"timeout_at"`
+	MultiUse       bool       `json:"multi_use" bson:"multi_use"`
+	ExpectedAmount *uint64    `json:"expected_amount,omitempty" bson:"expected_amount,omitempty"`
+	// the campaign the address belongs to, empty for the default campaign
+	Campaign string `json:"campaign,omitempty" bson:"campaign,omitempty"`
+}
+
+// NewDonationCDA creates the conditions of a donation from the given deposit address record.
+func NewDonationCDA(rec *CDA) *DonationCDA {
+	return &DonationCDA{
+		Address: rec.Address, TimeoutAt: rec.TimeoutAt, MultiUse: rec.MultiUse,
+		ExpectedAmount: rec.ExpectedAmount, Campaign: rec.Campaign,
+	}
+}
+
+// Received tells whether the donation is confirmed.
+func (d *Donation) Received() bool {
+	return d.ReceivedAt != nil
+}
+
+// DonationQuery filters and pages donations. Zero values mean no restriction.
+type DonationQuery struct {
+	// restricts the time when the donation was first seen
+	From *time.Time
+	To   *time.Time
+	// restricts the donated value
+	MinValue *uint64
+	MaxValue *uint64
+	// only include confirmed donations
+	ReceivedOnly bool
+	// only include donations of the given campaign
+	Campaign *string
+	Skip     int64
+	Limit    int64
+}
+
+// Matches tells whether the given donation satisfies the filters of the query.
+func (q *DonationQuery) Matches(d *Donation) bool {
+	switch {
+	case q.From != nil && d.ReceivingAt.Before(*q.From):
+		return false
+	case q.To != nil && d.ReceivingAt.After(*q.To):
+		return false
+	case q.MinValue != nil && d.Value < *q.MinValue:
+		return false
+	case q.MaxValue != nil && d.Value > *q.MaxValue:
+		return false
+	case q.ReceivedOnly && !d.Received():
+		return false
+	case q.Campaign != nil && d.Campaign != *q.Campaign:
+		return false
+	}
+	return true
+}
+
+// DonationStore persists the donations received by the server's accounts.
+type DonationStore interface {
+	// SaveDonation stores or overrides the given donation.
+	SaveDonation(d *Donation) error
+	// Donation returns the donation with the given id or nil if there is none.
+	Donation(id string) (*Donation, error)
+	// Donations returns the donations of the given account matching the query, newest first,
+	// together with the total count of matching donations.
+	Donations(accountID string, q *DonationQuery) ([]*Donation, int64, error)
+}
@@ -0,0 +1,302 @@
+package storage
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// KV is a minimal key/value persistence layer used by the KVStore.
+type KV interface {
+	// Put stores the value under the given key in the given bucket.
+	Put(bucket string, key string, value []byte) error
+	// Get returns the value under the given key in the given bucket or nil if there is none.
+	Get(bucket string, key string) ([]byte, error)
+	// Delete removes the given key from the given bucket.
+	Delete(bucket string, key string) error
+	// ForEach calls f for every key/value pair in the given bucket.
+	ForEach(bucket string, f func(key string, value []byte) error) error
+	// Close releases the resources held by the KV.
+	Close() error
+}
+
+// NewMemoryKV creates a new KV which only holds its data in memory.
+func NewMemoryKV() *MemoryKV {
+	return &MemoryKV{buckets: map[string]map[string][]byte{}}
+}
+
+// MemoryKV is an in-memory KV.
+type MemoryKV struct {
+	mu      sync.RWMutex
+	buckets map[string]map[string][]byte
+}
+
+func (mem *MemoryKV) Put(bucket string, key string, value []byte) error {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+	b, ok := mem.buckets[bucket]
+	if !ok {
+		b = map[string][]byte{}
+		mem.buckets[bucket] = b
+	}
+	b[key] = value
+	return nil
+}
+
+func (mem *MemoryKV) Get(bucket string, key string) ([]byte, error) {
+	mem.mu.RLock()
+	defer mem.mu.RUnlock()
+	return mem.buckets[bucket][key], nil
+}
+
+func (mem *MemoryKV) Delete(bucket string, key string) error {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+	delete(mem.buckets[bucket], key)
+	return nil
+}
+
+func (mem *MemoryKV) ForEach(bucket string, f func(key string, value []byte) error) error {
+	mem.mu.RLock()
+	defer mem.mu.RUnlock()
+	for k, v := range mem.buckets[bucket] {
+		if err := f(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (mem *MemoryKV) Close() error {
+	return nil
+}
+
+const (
+	cdaBucket      = "cda"
+	donationBucket = "donation"
+	sweepBucket    = "sweep"
+	webhookBucket  = "webhook"
+)
+
+// NewKVStore creates a new KVStore on top of the given KV.
+func NewKVStore(kv KV) *KVStore {
+	return &KVStore{kv: kv}
+}
+
+// KVStore is a store for the server's own data backed by a KV.
+// Queries are done by iterating over the whole bucket, therefore it is meant for small deployments.
+type KVStore struct {
+	kv KV
+	// serializes read-modify-write operations
+	mu sync.Mutex
+}
+
+func (s *KVStore) put(bucket string, key string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.kv.Put(bucket, key, b)
+}
+
+func (s *KVStore) AddCDA(rec *CDA) error {
+	return s.put(cdaBucket, rec.ID, rec)
+}
+
+func (s *KVStore) SetCurrentCDA(rec *CDA) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, err := s.CurrentCDA(rec.AccountID, rec.Campaign)
+	if err != nil {
+		return err
+	}
+	if current != nil {
+		current.Current = false
+		if err := s.AddCDA(current); err != nil {
+			return err
+		}
+	}
+	rec.Current = true
+	return s.AddCDA(rec)
+}
+
+func (s *KVStore) CurrentCDA(accountID string, campaign string) (*CDA, error) {
+	recs, err := s.CDAs(accountID)
+	if err != nil {
+		return nil, err
+	}
+	for _, rec := range recs {
+		if rec.Current && rec.Campaign == campaign {
+			return rec, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *KVStore) CDAs(accountID string) ([]*CDA, error) {
+	recs := []*CDA{}
+	err := s.kv.ForEach(cdaBucket, func(key string, value []byte) error {
+		rec := &CDA{}
+		if err := json.Unmarshal(value, rec); err != nil {
+			return errors.Wrapf(err, "unable to decode deposit condition %s", key)
+		}
+		if rec.AccountID == accountID {
+			recs = append(recs, rec)
+		}
+		return nil
+	})
+	return recs, err
+}
+
+// get decodes the value under the given key into v and reports whether the key existed.
+func (s *KVStore) get(bucket string, key string, v interface{}) (bool, error) {
+	b, err := s.kv.Get(bucket, key)
+	if err != nil || b == nil {
+		return false, err
+	}
+	return true, json.Unmarshal(b, v)
+}
+
+func (s *KVStore) CDA(id string) (*CDA, error) {
+	rec := &CDA{}
+	ok, err := s.get(cdaBucket, id, rec)
+	if !ok {
+		return nil, err
+	}
+	return rec, nil
+}
+
+func (s *KVStore) SaveDonation(d *Donation) error {
+	return s.put(donationBucket, d.ID, d)
+}
+
+func (s *KVStore) Donation(id string) (*Donation, error) {
+	d := &Donation{}
+	ok, err := s.get(donationBucket, id, d)
+	if !ok {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (s *KVStore) Donations(accountID string, q *DonationQuery) ([]*Donation, int64, error) {
+	donations := []*Donation{}
+	err := s.kv.ForEach(donationBucket, func(key string, value []byte) error {
+		d := &Donation{}
+		if err := json.Unmarshal(value, d); err != nil {
+			return errors.Wrapf(err, "unable to decode donation %s", key)
+		}
+		if d.AccountID == accountID && q.Matches(d) {
+			donations = append(donations, d)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	sort.Slice(donations, func(i, j int) bool {
+		return donations[i].ReceivingAt.After(donations[j].ReceivingAt)
+	})
+	return page(donations, q.Skip, q.Limit), int64(len(donations)), nil
+}
+
+func page(donations []*Donation, skip int64, limit int64) []*Donation {
+	if skip >= int64(len(donations)) {
+		return []*Donation{}
+	}
+	donations = donations[skip:]
+	if limit > 0 && limit < int64(len(donations)) {
+		donations = donations[:limit]
+	}
+	return donations
+}
+
+func (s *KVStore) AddSweep(sweep *Sweep) error {
+	return s.put(sweepBucket, sweep.ID, sweep)
+}
+
+func (s *KVStore) Sweeps(accountID string, limit int64) ([]*Sweep, error) {
+	sweeps := []*Sweep{}
+	err := s.kv.ForEach(sweepBucket, func(key string, value []byte) error {
+		sweep := &Sweep{}
+		if err := json.Unmarshal(value, sweep); err != nil {
+			return errors.Wrapf(err, "unable to decode sweep %s", key)
+		}
+		if sweep.AccountID == accountID {
+			sweeps = append(sweeps, sweep)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(sweeps, func(i, j int) bool {
+		return sweeps[i].At.After(sweeps[j].At)
+	})
+	if limit > 0 && limit < int64(len(sweeps)) {
+		sweeps = sweeps[:limit]
+	}
+	return sweeps, nil
+}
+
+func (s *KVStore) SaveDelivery(d *WebhookDelivery) error {
+	return s.put(webhookBucket, d.ID, d)
+}
+
+func (s *KVStore) deliveries(accountID string, match func(d *WebhookDelivery) bool) ([]*WebhookDelivery, error) {
+	deliveries := []*WebhookDelivery{}
+	err := s.kv.ForEach(webhookBucket, func(key string, value []byte) error {
+		d := &WebhookDelivery{}
+		if err := json.Unmarshal(value, d); err != nil {
+			return errors.Wrapf(err, "unable to decode webhook delivery %s", key)
+		}
+		if d.AccountID == accountID && match(d) {
+			deliveries = append(deliveries, d)
+		}
+		return nil
+	})
+	return deliveries, err
+}
+
+func (s *KVStore) DueDeliveries(accountID string, at time.Time, limit int64) ([]*WebhookDelivery, error) {
+	deliveries, err := s.deliveries(accountID, func(d *WebhookDelivery) bool {
+		return d.Status == DeliveryPending && !d.NextAttemptAt.After(at)
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].NextAttemptAt.Before(deliveries[j].NextAttemptAt)
+	})
+	if limit > 0 && limit < int64(len(deliveries)) {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+func (s *KVStore) Deliveries(accountID string, q *DeliveryQuery) ([]*WebhookDelivery, error) {
+	deliveries, err := s.deliveries(accountID, q.Matches)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].CreatedAt.After(deliveries[j].CreatedAt)
+	})
+	if q.Limit > 0 && q.Limit < int64(len(deliveries)) {
+		deliveries = deliveries[:q.Limit]
+	}
+	return deliveries, nil
+}
+
+// Ping reads from the underlying KV to check whether it is still usable.
+func (s *KVStore) Ping() error {
+	_, err := s.kv.Get(cdaBucket, "")
+	return err
+}
+
+// Close closes the underlying KV.
+func (s *KVStore) Close() error {
+	return s.kv.Close()
+}
@@ -0,0 +1,334 @@
+package storage
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+const (
+	DefaultCDACollName      = "deposit_conditions"
+	DefaultDonationCollName = "donations"
+	DefaultSweepCollName    = "sweeps"
+	DefaultWebhookCollName  = "webhook_deliveries"
+)
+
+const opTimeout = time.Duration(5) * time.Second
+
+// MongoConfig defines the database and collections used by the MongoStore.
+type MongoConfig struct {
+	DBName           string
+	CDACollName      string
+	DonationCollName string
+	SweepCollName    string
+	WebhookCollName  string
+}
+
+// NewMongoStore creates a new MongoStore and connects to the given MongoDB server.
+func NewMongoStore(uri string, cnf *MongoConfig) (*MongoStore, error) {
+	if cnf.CDACollName == "" {
+		cnf.CDACollName = DefaultCDACollName
+	}
+	if cnf.DonationCollName == "" {
+		cnf.DonationCollName = DefaultDonationCollName
+	}
+	if cnf.SweepCollName == "" {
+		cnf.SweepCollName = DefaultSweepCollName
+	}
+	if cnf.WebhookCollName == "" {
+		cnf.WebhookCollName = DefaultWebhookCollName
+	}
+	client, err := mongo.NewClient(options.Client().ApplyURI(uri))
+	if err != nil {
+		return nil, err
+	}
+	ms := &MongoStore{client: client, cnf: cnf}
+	if err := ms.init(); err != nil {
+		return nil, err
+	}
+	return ms, nil
+}
+
+// MongoStore is a MongoDB backed store for the server's own data.
+type MongoStore struct {
+	client    *mongo.Client
+	cnf       *MongoConfig
+	cdas      *mongo.Collection
+	donations *mongo.Collection
+	sweeps    *mongo.Collection
+	webhooks  *mongo.Collection
+}
+
+func (ms *MongoStore) init() error {
+	ctx, cancel := opCtx()
+	defer cancel()
+	if err := ms.client.Connect(ctx); err != nil {
+		return err
+	}
+	if err := ms.client.Ping(ctx, nil); err != nil {
+		// the context might have expired while pinging
+		disconnectCtx, cancelDisconnect := opCtx()
+		defer cancelDisconnect()
+		ms.client.Disconnect(disconnectCtx)
+		return err
+	}
+	db := ms.client.Database(ms.cnf.DBName)
+	ms.cdas = db.Collection(ms.cnf.CDACollName)
+	ms.donations = db.Collection(ms.cnf.DonationCollName)
+	ms.sweeps = db.Collection(ms.cnf.SweepCollName)
+	ms.webhooks = db.Collection(ms.cnf.WebhookCollName)
+	return nil
+}
+
+func opCtx() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), opTimeout)
+}
+
+func (ms *MongoStore) AddCDA(rec *CDA) error {
+	ctx, cancel := opCtx()
+	defer cancel()
+	_, err := ms.cdas.ReplaceOne(ctx, bson.M{"_id": rec.ID}, rec, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (ms *MongoStore) SetCurrentCDA(rec *CDA) error {
+	ctx, cancel := opCtx()
+	defer cancel()
+	filter := bson.M{"account_id": rec.AccountID, "campaign": campaignValue(rec.Campaign), "current": true}
+	if _, err := ms.cdas.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"current": false}}); err != nil {
+		return err
+	}
+	rec.Current = true
+	return ms.AddCDA(rec)
+}
+
+// campaignValue returns the filter value for the given campaign. The default campaign isn't stored,
+// so it is matched by null which matches missing fields.
+func campaignValue(campaign string) interface{} {
+	if campaign == "" {
+		return nil
+	}
+	return campaign
+}
+
+func (ms *MongoStore) CurrentCDA(accountID string, campaign string) (*CDA, error) {
+	ctx, cancel := opCtx()
+	defer cancel()
+	rec := &CDA{}
+	filter := bson.M{"account_id": accountID, "campaign": campaignValue(campaign), "current": true}
+	err := ms.cdas.FindOne(ctx, filter).Decode(rec)
+	switch err {
+	case nil:
+		return rec, nil
+	case mongo.ErrNoDocuments:
+		return nil, nil
+	default:
+		return nil, err
+	}
+}
+
+func (ms *MongoStore) CDAs(accountID string) ([]*CDA, error) {
+	ctx, cancel := opCtx()
+	defer cancel()
+	cursor, err := ms.cdas.Find(ctx, bson.M{"account_id": accountID})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	recs := []*CDA{}
+	for cursor.Next(ctx) {
+		rec := &CDA{}
+		if err := cursor.Decode(rec); err != nil {
+			return nil, err
+		}
+		recs = append(recs, rec)
+	}
+	return recs, cursor.Err()
+}
+
+func (ms *MongoStore) CDA(id string) (*CDA, error) {
+	ctx, cancel := opCtx()
+	defer cancel()
+	rec := &CDA{}
+	if err := ms.cdas.FindOne(ctx, bson.M{"_id": id}).Decode(rec); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return rec, nil
+}
+
+func (ms *MongoStore) SaveDonation(d *Donation) error {
+	ctx, cancel := opCtx()
+	defer cancel()
+	_, err := ms.donations.ReplaceOne(ctx, bson.M{"_id": d.ID}, d, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (ms *MongoStore) Donation(id string) (*Donation, error) {
+	ctx, cancel := opCtx()
+	defer cancel()
+	d := &Donation{}
+	if err := ms.donations.FindOne(ctx, bson.M{"_id": id}).Decode(d); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return d, nil
+}
+
+func donationFilter(accountID string, q *DonationQuery) bson.M {
+	filter := bson.M{"account_id": accountID}
+	receivingAt := bson.M{}
+	if q.From != nil {
+		receivingAt["$gte"] = *q.From
+	}
+	if q.To != nil {
+		receivingAt["$lte"] = *q.To
+	}
+	if len(receivingAt) > 0 {
+		filter["receiving_at"] = receivingAt
+	}
+	value := bson.M{}
+	if q.MinValue != nil {
+		value["$gte"] = int64(*q.MinValue)
+	}
+	if q.MaxValue != nil {
+		value["$lte"] = int64(*q.MaxValue)
+	}
+	if len(value) > 0 {
+		filter["value"] = value
+	}
+	if q.ReceivedOnly {
+		filter["received_at"] = bson.M{"$exists": true}
+	}
+	if q.Campaign != nil {
+		filter["campaign"] = campaignValue(*q.Campaign)
+	}
+	return filter
+}
+
+func (ms *MongoStore) Donations(accountID string, q *DonationQuery) ([]*Donation, int64, error) {
+	ctx, cancel := opCtx()
+	defer cancel()
+	filter := donationFilter(accountID, q)
+	total, err := ms.donations.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	opts := options.Find().SetSort(bson.M{"receiving_at": -1}).SetSkip(q.Skip)
+	if q.Limit > 0 {
+		opts.SetLimit(q.Limit)
+	}
+	cursor, err := ms.donations.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+	donations := []*Donation{}
+	for cursor.Next(ctx) {
+		d := &Donation{}
+		if err := cursor.Decode(d); err != nil {
+			return nil, 0, err
+		}
+		donations = append(donations, d)
+	}
+	return donations, total, cursor.Err()
+}
+
+func (ms *MongoStore) AddSweep(s *Sweep) error {
+	ctx, cancel := opCtx()
+	defer cancel()
+	_, err := ms.sweeps.InsertOne(ctx, s)
+	return err
+}
+
+func (ms *MongoStore) Sweeps(accountID string, limit int64) ([]*Sweep, error) {
+	ctx, cancel := opCtx()
+	defer cancel()
+	opts := options.Find().SetSort(bson.M{"at": -1})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+	cursor, err := ms.sweeps.Find(ctx, bson.M{"account_id": accountID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	sweeps := []*Sweep{}
+	for cursor.Next(ctx) {
+		s := &Sweep{}
+		if err := cursor.Decode(s); err != nil {
+			return nil, err
+		}
+		sweeps = append(sweeps, s)
+	}
+	return sweeps, cursor.Err()
+}
+
+func (ms *MongoStore) SaveDelivery(d *WebhookDelivery) error {
+	ctx, cancel := opCtx()
+	defer cancel()
+	_, err := ms.webhooks.ReplaceOne(ctx, bson.M{"_id": d.ID}, d, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (ms *MongoStore) findDeliveries(filter bson.M, opts *options.FindOptions) ([]*WebhookDelivery, error) {
+	ctx, cancel := opCtx()
+	defer cancel()
+	cursor, err := ms.webhooks.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	deliveries := []*WebhookDelivery{}
+	for cursor.Next(ctx) {
+		d := &WebhookDelivery{}
+		if err := cursor.Decode(d); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, cursor.Err()
+}
+
+func (ms *MongoStore) DueDeliveries(accountID string, at time.Time, limit int64) ([]*WebhookDelivery, error) {
+	filter := bson.M{"account_id": accountID, "status": DeliveryPending, "next_attempt_at": bson.M{"$lte": at}}
+	opts := options.Find().SetSort(bson.M{"next_attempt_at": 1})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+	return ms.findDeliveries(filter, opts)
+}
+
+func (ms *MongoStore) Deliveries(accountID string, q *DeliveryQuery) ([]*WebhookDelivery, error) {
+	filter := bson.M{"account_id": accountID}
+	if q.Status != "" {
+		filter["status"] = q.Status
+	}
+	if q.Endpoint != "" {
+		filter["endpoint"] = q.Endpoint
+	}
+	opts := options.Find().SetSort(bson.M{"created_at": -1})
+	if q.Limit > 0 {
+		opts.SetLimit(q.Limit)
+	}
+	return ms.findDeliveries(filter, opts)
+}
+
+func (ms *MongoStore) Ping() error {
+	ctx, cancel := opCtx()
+	defer cancel()
+	return ms.client.Ping(ctx, nil)
+}
+
+// Close disconnects the store from MongoDB.
+func (ms *MongoStore) Close() error {
+	ctx, cancel := opCtx()
+	defer cancel()
+	return ms.client.Disconnect(ctx)
+}
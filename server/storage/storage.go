@@ -0,0 +1,14 @@
+// Package storage persists the data the server keeps next to the account state.
+package storage
+
+// Store is the persistence layer for the server's own data.
+type Store interface {
+	CDAStore
+	DonationStore
+	SweepStore
+	WebhookStore
+	// Ping checks whether the store is reachable.
+	Ping() error
+	// Close releases the resources held by the store.
+	Close() error
+}
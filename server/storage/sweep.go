@@ -0,0 +1,29 @@
+package storage
+
+import (
+	"time"
+)
+
+// Sweep is a transfer of the account's funds to the cold wallet.
+type Sweep struct {
+	// the bundle hash of the sweep transfer or a generated id for failed sweeps
+	ID        string `json:"id" bson:"_id"`
+	AccountID string `json:"account_id" bson:"account_id"`
+	Address   string `json:"address,omitempty" bson:"address"`
+	Value     uint64 `json:"value" bson:"value"`
+	Tail      string `json:"tail,omitempty" bson:"tail,omitempty"`
+	// what triggered the sweep, either "threshold", "schedule" or "manual"
+	Reason string    `json:"reason" bson:"reason"`
+	At     time.Time `json:"at" bson:"at"`
+	// set if the sweep failed
+	Error string `json:"error,omitempty" bson:"error,omitempty"`
+}
+
+// SweepStore persists the sweeps of the server's accounts.
+type SweepStore interface {
+	// AddSweep stores the given sweep.
+	AddSweep(s *Sweep) error
+	// Sweeps returns the most recent sweeps of the given account, newest first.
+	// A limit of 0 returns all sweeps.
+	Sweeps(accountID string, limit int64) ([]*Sweep, error)
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"time"
+)
+
+// webhook delivery states
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookDelivery is an event which is delivered to a webhook endpoint.
+type WebhookDelivery struct {
+	ID        string `json:"id" bson:"_id"`
+	AccountID string `json:"account_id" bson:"account_id"`
+	// the id of the configured endpoint
+	Endpoint string `json:"endpoint" bson:"endpoint"`
+	Event    string `json:"event" bson:"event"`
+	// the signed request body, kept as is so that retries are signed identically
+	Payload string `json:"payload" bson:"payload"`
+	// either "pending", "delivered" or "failed"
+	Status        string     `json:"status" bson:"status"`
+	Attempts      int        `json:"attempts" bson:"attempts"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" bson:"next_attempt_at"`
+	LastAttemptAt *time.Time `json:"last_attempt_at,omitempty" bson:"last_attempt_at,omitempty"`
+	// the HTTP status code of the last attempt, 0 if no response was received
+	LastStatusCode int        `json:"last_status_code,omitempty" bson:"last_status_code,omitempty"`
+	LastError      string     `json:"last_error,omitempty" bson:"last_error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at" bson:"created_at"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty" bson:"delivered_at,omitempty"`
+}
+
+// DeliveryQuery filters webhook deliveries. Zero values mean no restriction.
+type DeliveryQuery struct {
+	Status   string
+	Endpoint string
+	Limit    int64
+}
+
+// Matches tells whether the given delivery satisfies the filters of the query.
+func (q *DeliveryQuery) Matches(d *WebhookDelivery) bool {
+	switch {
+	case q.Status != "" && d.Status != q.Status:
+		return false
+	case q.Endpoint != "" && d.Endpoint != q.Endpoint:
+		return false
+	}
+	return true
+}
+
+// WebhookStore persists the webhook deliveries of the server's accounts.
+type WebhookStore interface {
+	// SaveDelivery stores or overrides the given delivery.
+	SaveDelivery(d *WebhookDelivery) error
+	// DueDeliveries returns the pending deliveries of the given account which are due at the given time, oldest first.
+	DueDeliveries(accountID string, at time.Time, limit int64) ([]*WebhookDelivery, error)
+	// Deliveries returns the deliveries of the given account matching the query, newest first.
+	Deliveries(accountID string, q *DeliveryQuery) ([]*WebhookDelivery, error)
+}
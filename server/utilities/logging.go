@@ -5,18 +5,32 @@ import (
 	"gopkg.in/inconshreveable/log15.v2"
 	"fmt"
 	"github.com/mattn/go-colorable"
+	"path/filepath"
+	"sync/atomic"
 )
 
-var Debug = false
+// the highest level which is logged, switched by SetDebug
+var level = int32(log15.LvlInfo)
 
-func init() {
-	os.Mkdir("./logs", 0777)
+// SetDebug switches all loggers, including the already created ones, between logging debug and info messages.
+func SetDebug(debug bool) {
+	lvl := log15.LvlInfo
+	if debug {
+		lvl = log15.LvlDebug
+	}
+	atomic.StoreInt32(&level, int32(lvl))
 }
 
+// the directory holding the log files, set from the data directory of the config
+var LogDir = "./logs"
+
 func GetLogger(name string) (log15.Logger, error) {
+	if err := os.MkdirAll(LogDir, 0777); err != nil {
+		return nil, err
+	}
 
 	// open a new logfile
-	fileHandler, err := log15.FileHandler(fmt.Sprintf("./logs/%s.log", name), log15.LogfmtFormat())
+	fileHandler, err := log15.FileHandler(filepath.Join(LogDir, fmt.Sprintf("%s.log", name)), log15.LogfmtFormat())
 	if err != nil {
 		return nil, err
 	}
@@ -25,9 +39,9 @@ func GetLogger(name string) (log15.Logger, error) {
 		fileHandler,
 		log15.StreamHandler(colorable.NewColorableStdout(), log15.TerminalFormat()),
 	)
-	if !Debug {
-		handler = log15.LvlFilterHandler(log15.LvlInfo, handler)
-	}
+	handler = log15.FilterHandler(func(r *log15.Record) bool {
+		return r.Lvl <= log15.Lvl(atomic.LoadInt32(&level))
+	}, handler)
 	logger := log15.New("comp", name)
 	logger.SetHandler(handler)
 	return logger, nil
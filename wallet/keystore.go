@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/luca-moser/donapoc/server/keystore"
+	"github.com/pkg/errors"
+	"os"
+)
+
+// loadSeed returns the seed from the configured keystore or the plaintext seed of the config.
+func loadSeed(conf *config) (string, error) {
+	if conf.Keystore.File == "" {
+		if conf.Seed == "" {
+			return "", errors.New("neither a keystore nor a seed is configured")
+		}
+		logger.Warn("using plaintext seed from config, convert it with the 'keystore' command")
+		return conf.Seed, nil
+	}
+	return keystore.Open(conf.Keystore.File, func() (string, error) {
+		return keystore.Passphrase(conf.Keystore.PassphraseFile)
+	})
+}
+
+// convertSeed encrypts the plaintext seed of the config into a new keystore file.
+//
+//	keystore [-out <file>]
+func convertSeed(conf *config, args []string) error {
+	fs := flag.NewFlagSet("keystore", flag.ExitOnError)
+	out := fs.String("out", "wallet.keystore", "the keystore file to create")
+	fs.Parse(args)
+	if conf.Seed == "" {
+		return errors.New("seed isn't set, there is nothing to convert")
+	}
+	if _, err := os.Stat(*out); err == nil {
+		return fmt.Errorf("%s already exists", *out)
+	}
+
+	passphrase, err := keystore.NewPassphrase(conf.Keystore.PassphraseFile)
+	if err != nil {
+		return err
+	}
+	ks, err := keystore.Encrypt(conf.Seed, passphrase)
+	if err != nil {
+		return err
+	}
+	if err := keystore.WriteFile(*out, ks); err != nil {
+		return errors.Wrapf(err, "unable to write keystore %s", *out)
+	}
+	logger.Infof("wrote keystore %s, set keystore.file to it and remove the seed from %s", *out, configFile)
+	return nil
+}
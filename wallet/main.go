@@ -17,6 +17,7 @@ import (
 	"github.com/iotaledger/iota.go/account/timesrc"
 	"github.com/iotaledger/iota.go/api"
 	"github.com/iotaledger/iota.go/consts"
+	srvconfig "github.com/luca-moser/donapoc/server/server/config"
 	"github.com/pkg/errors"
 	"io/ioutil"
 	"net/http"
@@ -27,7 +28,7 @@ import (
 )
 
 const configFile = "wallet.json"
-const dateFormat = "2006-02-01 15:04:05"
+const dateFormat = "2006-01-02 15:04:05"
 
 var logger *log.Logger
 
@@ -51,6 +52,28 @@ func main() {
 	logger = log.New(os.Stdout)
 	conf := readConfig()
 
+	// the check-config command reports all problems of the config at once
+	if len(os.Args) > 1 && os.Args[1] == "check-config" {
+		if err := conf.validate(); err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+		logger.Info("config OK")
+		return
+	}
+	must(conf.validate())
+
+	// the keystore command converts the plaintext seed of the config
+	if len(os.Args) > 1 && os.Args[1] == "keystore" {
+		if err := convertSeed(conf, os.Args[2:]); err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+	seed, err := loadSeed(conf)
+	must(err)
+
 	// compose quorum API
 	quorumConf := conf.Quorum
 	httpClient := &http.Client{Timeout: time.Duration(quorumConf.Timeout) * time.Second}
@@ -71,6 +94,15 @@ func main() {
 	})
 	must(err)
 
+	// run the export/import command instead of the wallet if one is given
+	if len(os.Args) > 1 {
+		if err := runCommand(seed, dataStore, os.Args[1], os.Args[2:]); err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
 	// init NTP time source
 	ntpClock := timesrc.NewNTPTimeSource(conf.Time.NTPServer)
 
@@ -81,7 +113,7 @@ func main() {
 	b := builder.NewBuilder().
 		WithAPI(iotaAPI).
 		WithStore(dataStore).
-		WithSeed(conf.Seed).
+		WithSeed(seed).
 		WithTimeSource(ntpClock).
 		WithSecurityLevel(consts.SecurityLevel(conf.SecurityLevel)).
 		WithMWM(conf.MWM).
@@ -113,7 +145,7 @@ func main() {
 	// generate a deposit address which expires in 2 hours
 	now = now.Add(time.Duration(2) * time.Hour)
 	logger.Infof("generating fresh deposit address with validity until %s....\n", now.Format(dateFormat))
-	depCond, err := acc.AllocateDepositRequest(&deposit.Request{TimeoutAt: &now})
+	depCond, err := acc.AllocateDepositAddress(&deposit.Conditions{TimeoutAt: &now})
 	must(err)
 	logger.Info("own address: ", depCond.Address)
 
@@ -220,21 +252,19 @@ func printBalance(acc account.Account) {
 }
 
 type config struct {
-	Seed   string `json:"seed"`
-	Quorum struct {
-		PrimaryNode                string   `json:"primary_node"`
-		Nodes                      []string `json:"nodes"`
-		Threshold                  float64  `json:"threshold"`
-		NoResponseTolerance        float64  `json:"no_response_tolerance"`
-		MaxSubtangleMilestoneDelta uint64   `json:"max_subtangle_milestone_delta"`
-		Timeout                    uint64   `json:"timeout"`
-	} `json:"quorum"`
-	MWM                        uint64 `json:"mwm"`
-	GTTADepth                  uint64 `json:"gtta_depth"`
-	SecurityLevel              uint64 `json:"security_level"`
-	TransferPollInterval       uint64 `json:"transfer_poll_interval"`
-	PromoteReattachInterval    uint64 `json:"promote_reattach_interval"`
-	AddressValidityTimeoutDays uint64 `json:"address_validity_timeout_days"`
+	// plaintext seed, prefer a keystore
+	Seed     string `json:"seed"`
+	Keystore struct {
+		File           string `json:"file"`
+		PassphraseFile string `json:"passphrase_file"`
+	} `json:"keystore"`
+	Quorum                     srvconfig.QuorumConfig `json:"quorum"`
+	MWM                        uint64                 `json:"mwm"`
+	GTTADepth                  uint64                 `json:"gtta_depth"`
+	SecurityLevel              uint64                 `json:"security_level"`
+	TransferPollInterval       uint64                 `json:"transfer_poll_interval"`
+	PromoteReattachInterval    uint64                 `json:"promote_reattach_interval"`
+	AddressValidityTimeoutDays uint64                 `json:"address_validity_timeout_days"`
 	Time                       struct {
 		NTPServer string `json:"ntp_server"`
 	} `json:"time"`
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/iotaledger/iota.go/account/builder"
+	"github.com/iotaledger/iota.go/account/store"
+	"github.com/luca-moser/donapoc/server/statefile"
+	"github.com/pkg/errors"
+)
+
+// runCommand exports or imports the account state. The account isn't started,
+// as it keeps its key index in memory while running.
+//
+//	export <file>
+//	import [-force] <file>
+func runCommand(seed string, dataStore store.Store, name string, args []string) error {
+	// the account id is derived from the seed
+	acc, err := builder.NewBuilder().WithStore(dataStore).WithSeed(seed).Build()
+	if err != nil {
+		return errors.Wrap(err, "unable to instantiate account")
+	}
+
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	switch name {
+	case "export":
+		fs.Parse(args)
+		if fs.NArg() != 1 {
+			return fmt.Errorf("usage: export <file>")
+		}
+		state, err := statefile.Export(dataStore, acc.ID())
+		if err != nil {
+			return err
+		}
+		if err := statefile.WriteFile(fs.Arg(0), state); err != nil {
+			return errors.Wrapf(err, "unable to write state file %s", fs.Arg(0))
+		}
+		logger.Infof("exported %s to %s", state.Summary(), fs.Arg(0))
+	case "import":
+		force := fs.Bool("force", false, "import a state exported from another account")
+		fs.Parse(args)
+		if fs.NArg() != 1 {
+			return fmt.Errorf("usage: import [-force] <file>")
+		}
+		state, err := statefile.ReadFile(fs.Arg(0))
+		if err != nil {
+			return errors.Wrapf(err, "unable to read state file %s", fs.Arg(0))
+		}
+		if err := statefile.Import(dataStore, state, acc.ID(), *force); err != nil {
+			return err
+		}
+		logger.Infof("imported %s from %s", state.Summary(), fs.Arg(0))
+	default:
+		return fmt.Errorf("unknown command '%s', available: export, import, keystore", name)
+	}
+	return nil
+}
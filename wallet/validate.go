@@ -0,0 +1,32 @@
+package main
+
+import (
+	srvconfig "github.com/luca-moser/donapoc/server/server/config"
+)
+
+// validate checks the config and returns a report of all problems found or nil if there are none.
+func (conf *config) validate() error {
+	r := &srvconfig.Report{}
+	if conf.Keystore.File != "" {
+		r.File("keystore.file", conf.Keystore.File)
+		if conf.Keystore.PassphraseFile != "" {
+			r.File("keystore.passphrase_file", conf.Keystore.PassphraseFile)
+		}
+	} else if conf.Seed == "" {
+		r.Addf("keystore.file", "either a keystore or a seed must be configured")
+	} else {
+		r.Seed("seed", conf.Seed)
+	}
+	r.Quorum("quorum", conf.Quorum)
+	r.NonZero("mwm", conf.MWM)
+	r.NonZero("gtta_depth", conf.GTTADepth)
+	r.SecurityLevel("security_level", conf.SecurityLevel)
+	r.NonZero("transfer_poll_interval", conf.TransferPollInterval)
+	r.NonZero("promote_reattach_interval", conf.PromoteReattachInterval)
+	r.NonZero("address_validity_timeout_days", conf.AddressValidityTimeoutDays)
+	r.NonEmpty("time.ntp_server", conf.Time.NTPServer)
+	r.MongoURI("mongodb.uri", conf.MongoDB.URI)
+	r.NonEmpty("mongodb.dbname", conf.MongoDB.DBName)
+	r.NonEmpty("mongodb.collname", conf.MongoDB.CollName)
+	return r.Err()
+}